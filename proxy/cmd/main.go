@@ -1,19 +1,32 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"expvar"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	_ "test/docs"
 
 	"test/config"
+	"test/internal/audit"
 	"test/internal/auth"
 	"test/internal/controller"
+	"test/internal/database"
+	"test/internal/mailer"
 	"test/internal/service"
+	"test/internal/tenant"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jwt"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 )
 
@@ -36,33 +49,468 @@ import (
 // @in header
 // @name Authorization
 // @description Type "Bearer" followed by a space and JWT token.
+
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description API key of a machine client, e.g. hp_9f86d081_...
+
+// @securityDefinitions.basic BasicAuth
+// @description Client credentials of a service calling token introspection.
+// oidcStateTTL is how long a user has to complete an OIDC login.
+const oidcStateTTL = 10 * time.Minute
+
 func main() {
 	var config = config.LoadConfig()
-	var user = &auth.User{}
-	var tokenAuth *jwtauth.JWTAuth = jwtauth.New("HS256", []byte(config.JwtSecret), nil)
-	geoService := service.NewGeoService(config.DaDataAPIKey, config.DaDataSecretKey)
-	geoController := controller.NewGeoController(geoService, tokenAuth)
-	authController := auth.NewAuthController(tokenAuth, user)
+	validateOptions := []jwt.ValidateOption{
+		jwt.WithAcceptableSkew(config.JwtClockSkew),
+		jwt.WithIssuer(config.JwtIssuer),
+		jwt.WithAudience(config.JwtAudience),
+		jwt.WithRequiredClaim("exp"),
+		jwt.WithRequiredClaim("iat"),
+		jwt.WithRequiredClaim("jti"),
+	}
+
+	var keyRing *auth.KeyRing
+	if config.JwtKeysDir != "" {
+		var err error
+		keyRing, err = auth.OpenKeyRing(auth.KeyRingConfig{
+			Algorithm:        config.JwtAlgorithm,
+			Dir:              config.JwtKeysDir,
+			RotationInterval: config.JwtRotation,
+			MaxTokenLifetime: max(config.AccessTokenTTL, config.MFAChallengeTTL, oidcStateTTL) + config.JwtClockSkew,
+			ValidateOptions:  validateOptions,
+		})
+		if err != nil {
+			log.Fatalf("open key ring %s: %v", config.JwtKeysDir, err)
+		}
+		go keyRing.StartRotation(context.Background(), time.Minute)
+
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		go func() {
+			for range reload {
+				if err := keyRing.Reload(); err != nil {
+					log.Println("reload signing keys:", err)
+					continue
+				}
+				log.Println("signing keys reloaded")
+			}
+		}()
+	} else {
+		signingKey, err := auth.LoadSigningKey(config.JwtAlgorithm, config.JwtSecret, config.JwtPrivateKey, config.JwtKeyID)
+		if err != nil {
+			log.Fatalf("load signing key: %v", err)
+		}
+		keyRing, err = auth.NewStaticKeyRing(signingKey, validateOptions...)
+		if err != nil {
+			log.Fatalf("init signing key: %v", err)
+		}
+	}
+
+	var users auth.UserRepository
+	var refreshTokens auth.RefreshTokenRepository
+	var revocations auth.RevocationRepository
+	var roles auth.RoleRepository
+	var apiKeys auth.CredentialRepository
+	var personalTokens auth.CredentialRepository
+	var passwordResets auth.PasswordResetRepository
+	var emailVerifications auth.EmailVerificationRepository
+	var oidcIdentities auth.OIDCIdentityRepository
+	var mfaRepo auth.MFARepository
+	var tenants tenant.Repository
+	var db *sql.DB
+	switch config.UserStore {
+	case "memory":
+		users = auth.NewMemoryUserRepository()
+		refreshTokens = auth.NewMemoryRefreshTokenRepository()
+		roles = auth.NewMemoryRoleRepository()
+		apiKeys = auth.NewMemoryCredentialRepository()
+		personalTokens = auth.NewMemoryCredentialRepository()
+		passwordResets = auth.NewMemoryPasswordResetRepository()
+		emailVerifications = auth.NewMemoryEmailVerificationRepository()
+		oidcIdentities = auth.NewMemoryOIDCIdentityRepository()
+		mfaRepo = auth.NewMemoryMFARepository()
+		tenants = tenant.NewMemoryRepository()
+	default:
+		var err error
+		db, err = database.OpenSQLite(config.DatabasePath)
+		if err != nil {
+			log.Fatalf("open database %s: %v", config.DatabasePath, err)
+		}
+		defer db.Close()
+
+		users, err = auth.NewSQLiteUserRepository(db)
+		if err != nil {
+			log.Fatalf("init user repository: %v", err)
+		}
+		refreshTokens, err = auth.NewSQLiteRefreshTokenRepository(db)
+		if err != nil {
+			log.Fatalf("init refresh token repository: %v", err)
+		}
+		revocations, err = auth.NewSQLiteRevocationRepository(db)
+		if err != nil {
+			log.Fatalf("init revocation repository: %v", err)
+		}
+		roles, err = auth.NewSQLiteRoleRepository(db)
+		if err != nil {
+			log.Fatalf("init role repository: %v", err)
+		}
+		apiKeys, err = auth.NewSQLiteAPIKeyRepository(db)
+		if err != nil {
+			log.Fatalf("init api key repository: %v", err)
+		}
+		personalTokens, err = auth.NewSQLitePersonalTokenRepository(db)
+		if err != nil {
+			log.Fatalf("init personal access token repository: %v", err)
+		}
+		passwordResets, err = auth.NewSQLitePasswordResetRepository(db)
+		if err != nil {
+			log.Fatalf("init password reset repository: %v", err)
+		}
+		emailVerifications, err = auth.NewSQLiteEmailVerificationRepository(db)
+		if err != nil {
+			log.Fatalf("init email verification repository: %v", err)
+		}
+		oidcIdentities, err = auth.NewSQLiteOIDCIdentityRepository(db)
+		if err != nil {
+			log.Fatalf("init oidc identity repository: %v", err)
+		}
+		mfaRepo, err = auth.NewSQLiteMFARepository(db)
+		if err != nil {
+			log.Fatalf("init mfa repository: %v", err)
+		}
+		tenants, err = tenant.NewSQLiteRepository(db)
+		if err != nil {
+			log.Fatalf("init tenant repository: %v", err)
+		}
+	}
+
+	roleService := auth.NewRoleService(roles, users, config.AdminUsernames)
+	if err := roleService.Seed(context.Background()); err != nil {
+		log.Fatalf("seed roles: %v", err)
+	}
+
+	denylist := auth.NewDenylist(revocations, config.AccessTokenTTL)
+	if err := denylist.Load(context.Background()); err != nil {
+		log.Fatalf("load token denylist: %v", err)
+	}
+	go denylist.StartCleanup(context.Background(), time.Minute)
+
+	passwordPolicy := &auth.PasswordPolicy{
+		MinLength:     config.PasswordMinLength,
+		RequireUpper:  config.PasswordRequireUpper,
+		RequireLower:  config.PasswordRequireLower,
+		RequireDigit:  config.PasswordRequireDigit,
+		RequireSymbol: config.PasswordRequireSymbol,
+	}
+	if config.BreachedPasswordsFile != "" {
+		if err := passwordPolicy.LoadBreachedPasswords(config.BreachedPasswordsFile); err != nil {
+			log.Fatalf("load breached passwords: %v", err)
+		}
+	}
+
+	bcryptHasher := &auth.BcryptHasher{Cost: config.BcryptCost}
+	argon2Hasher := &auth.Argon2idHasher{
+		Memory:      uint32(config.Argon2Memory),
+		Iterations:  uint32(config.Argon2Iterations),
+		Parallelism: uint8(config.Argon2Parallelism),
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+	var passwordHashers []auth.PasswordHashAlgorithm
+	if config.PasswordHashAlgorithm == "bcrypt" {
+		passwordHashers = []auth.PasswordHashAlgorithm{bcryptHasher, argon2Hasher}
+	} else {
+		passwordHashers = []auth.PasswordHashAlgorithm{argon2Hasher, bcryptHasher}
+	}
+	passwordHasher, err := auth.NewPasswordHasher(passwordHashers[0], passwordHashers[1:]...)
+	if err != nil {
+		log.Fatalf("init password hasher: %v", err)
+	}
+
+	var auditLog audit.MultiLogger
+	// auditEvents is nil unless a sink that can be searched is configured.
+	var auditEvents audit.Querier
+	for _, sink := range config.AuditSinks {
+		switch sink {
+		case "sqlite":
+			if db == nil {
+				var err error
+				db, err = database.OpenSQLite(config.DatabasePath)
+				if err != nil {
+					log.Fatalf("open database %s: %v", config.DatabasePath, err)
+				}
+				defer db.Close()
+			}
+			sqliteLog, err := audit.NewSQLiteLogger(db)
+			if err != nil {
+				log.Fatalf("init audit log: %v", err)
+			}
+			auditLog = append(auditLog, sqliteLog)
+			auditEvents = sqliteLog
+		default:
+			if config.AuditLogFile == "" {
+				auditLog = append(auditLog, audit.NewJSONLogger(os.Stdout))
+				continue
+			}
+			fileLog, f, err := audit.OpenFile(config.AuditLogFile)
+			if err != nil {
+				log.Fatalf("open audit log %s: %v", config.AuditLogFile, err)
+			}
+			defer f.Close()
+			auditLog = append(auditLog, fileLog)
+		}
+	}
+
+	loginGuard := auth.NewLoginGuard(auth.LockoutConfig{
+		MaxFailures:      config.LoginMaxFailures,
+		MaxFailuresPerIP: config.LoginMaxFailuresPerIP,
+		BaseLockout:      config.LoginLockoutBase,
+		MaxLockout:       config.LoginLockoutMax,
+		ResetAfter:       config.LoginFailureReset,
+	}, auditLog)
+	go loginGuard.StartCleanup(context.Background(), time.Minute)
+
+	var mail mailer.Mailer
+	switch config.Mailer {
+	case "smtp":
+		mail = mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Host:     config.SMTPHost,
+			Port:     config.SMTPPort,
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+			From:     config.MailFrom,
+		})
+	case "file":
+		fileMailer, err := mailer.NewFileMailer(config.MailDir, config.MailFrom)
+		if err != nil {
+			log.Fatalf("init file mailer: %v", err)
+		}
+		mail = fileMailer
+	default:
+		mail = mailer.NewLogMailer()
+	}
+
+	geoRegistry := service.DefaultRegistry()
+	geoProvider, err := geoRegistry.New(config.GeoProvider, config.GeoSettings)
+	if err != nil {
+		log.Fatalf("init geo provider (settings are read from %s_* variables): %v", strings.ToUpper(config.GeoProvider), err)
+	}
+	tenantLimiter := tenant.NewLimiter()
+	tenantGeo := tenant.NewGeoServices(geoRegistry, config.GeoProvider, config.GeoSettings)
+	geoController := controller.NewGeoController(geoProvider, tenantGeo)
+	tokenService := auth.NewTokenService(keyRing, refreshTokens, users, roleService, denylist, []auth.CredentialRepository{apiKeys, personalTokens}, auditLog, auth.TokenConfig{
+		AccessTTL:  config.AccessTokenTTL,
+		RefreshTTL: config.RefreshTokenTTL,
+		Issuer:     config.JwtIssuer,
+		Audience:   config.JwtAudience,
+	})
+	passwordResetService := auth.NewPasswordResetService(passwordResets, users, tokenService, mail, passwordPolicy, passwordHasher, loginGuard, auditLog, auth.PasswordResetConfig{
+		TTL: config.PasswordResetTTL,
+		URL: config.PasswordResetURL,
+	})
+	passwordController := auth.NewPasswordController(passwordResetService)
+	apiKeyService := auth.NewAPIKeyService(apiKeys, users, roleService)
+	personalTokenService := auth.NewPersonalTokenService(personalTokens, users, roleService)
+	emailVerification := auth.NewEmailVerificationService(emailVerifications, users, mail, auth.EmailVerificationConfig{
+		TTL:            config.EmailVerificationTTL,
+		URL:            config.PublicURL + "/api/email/verify",
+		ResendInterval: config.EmailVerificationResendInterval,
+	})
+	go emailVerification.StartCleanup(context.Background(), time.Minute)
+	verificationController := auth.NewVerificationController(emailVerification)
+	var requiredVerification *auth.EmailVerificationService
+	if config.EmailVerificationRequired {
+		requiredVerification = emailVerification
+	}
+	var sessions *auth.Sessions
+	tokenSources := []func(r *http.Request) string{jwtauth.TokenFromHeader}
+	if config.SessionCookies {
+		sameSite := http.SameSiteStrictMode
+		if config.SessionCookieSameSite == "lax" {
+			sameSite = http.SameSiteLaxMode
+		}
+		sessions = auth.NewSessions(auth.SessionConfig{
+			Secure:     config.SessionCookieSecure,
+			SameSite:   sameSite,
+			RefreshTTL: config.RefreshTokenTTL,
+		})
+		tokenSources = append(tokenSources, sessions.TokenFromCookie)
+	}
+	mfaService := auth.NewMFAService(mfaRepo, keyRing, auth.MFAConfig{
+		Issuer:       config.MFAIssuer,
+		TokenIssuer:  config.JwtIssuer,
+		ChallengeTTL: config.MFAChallengeTTL,
+	})
+	authController := auth.NewAuthController(tokenService, users, roleService, passwordPolicy, passwordHasher, loginGuard, requiredVerification, sessions, mfaService, auditLog)
+	mfaController := auth.NewMFAController(mfaService, users, loginGuard)
+	apiKeyController := auth.NewAPIKeyController(apiKeyService)
+	personalTokenController := auth.NewPersonalTokenController(personalTokenService, auditLog)
+	adminController := auth.NewAdminController(users, roleService, tokenService, keyRing, loginGuard, mfaService, passwordResetService, auditLog)
+	tenantController := auth.NewTenantController(tenants, users, tokenService, roleService, mfaService, tenantLimiter, tenantGeo, auditLog)
+	var auditController *auth.AuditController
+	if auditEvents != nil {
+		auditController = auth.NewAuditController(auditEvents)
+	}
+	introspectionService := auth.NewIntrospectionService(keyRing, denylist, users, apiKeyService, personalTokenService, config.IntrospectionClients)
+	introspectionController := auth.NewIntrospectionController(introspectionService)
+	discoveryController := auth.NewDiscoveryController(keyRing, config.JwtIssuer, config.PublicURL)
+
+	var oidcController *auth.OIDCController
+	if config.OIDCIssuer != "" {
+		oidcService, err := auth.NewOIDCService(context.Background(), oidcIdentities, users, roleService, keyRing, auth.OIDCConfig{
+			Issuer:        config.OIDCIssuer,
+			ClientID:      config.OIDCClientID,
+			ClientSecret:  config.OIDCClientSecret,
+			RedirectURL:   config.OIDCRedirectURL,
+			Scopes:        config.OIDCScopes,
+			UsernameClaim: config.OIDCUsernameClaim,
+			EmailClaim:    config.OIDCEmailClaim,
+			NameClaim:     config.OIDCNameClaim,
+			StateIssuer:   config.JwtIssuer,
+			StateTTL:      oidcStateTTL,
+			ClockSkew:     config.JwtClockSkew,
+		})
+		if err != nil {
+			log.Fatalf("init oidc provider %s: %v", config.OIDCIssuer, err)
+		}
+		oidcController = auth.NewOIDCController(oidcService, tokenService, strings.HasPrefix(config.PublicURL, "https://"), sessions, auditLog)
+	}
 
 	// Initialize router
 	r := chi.NewRouter()
+	if config.TrustProxyHeaders {
+		r.Use(middleware.RealIP)
+	}
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Logger)
+	r.Use(audit.Middleware)
 
 	r.Get("/swagger/*", httpSwagger.Handler(
 		httpSwagger.URL("http://localhost:8080/swagger/doc.json"),
 	))
 
+	r.Get("/.well-known/jwks.json", discoveryController.JWKS())
+	r.Get("/.well-known/openid-configuration", discoveryController.OpenIDConfiguration())
+
 	r.Route("/api", func(r chi.Router) {
 		r.Post("/register", authController.Register())
 		r.Post("/login", authController.Login())
+		r.Post("/login/mfa", authController.LoginMFA())
+		if sessions != nil {
+			r.With(sessions.CSRF).Post("/token/refresh", authController.Refresh())
+		} else {
+			r.Post("/token/refresh", authController.Refresh())
+		}
+		r.Post("/token/introspect", introspectionController.Introspect())
+		r.Post("/password/forgot", passwordController.Forgot())
+		r.Post("/password/reset", passwordController.Reset())
+		r.Get("/email/verify", verificationController.Verify())
+		if oidcController != nil {
+			r.Get("/oidc/login", oidcController.Login())
+			r.Get("/oidc/callback", oidcController.Callback())
+		}
+
+		// Address routes also accept API keys of machine clients.
+		r.Group(func(r chi.Router) {
+			r.Use(auth.APIKeyVerifier(apiKeyService))
+			r.Use(auth.PersonalTokenVerifier(personalTokenService))
+			if sessions != nil {
+				r.Use(sessions.CSRF)
+			}
+			r.Use(auth.Verifier(keyRing, tokenSources...))
+			r.Use(auth.CheckRevoked(denylist))
+			r.Use(auth.Authenticator)
+			r.Use(auth.RejectDisabled(users))
+			if config.EmailVerificationRequired {
+				r.Use(auth.RequireVerifiedEmail(users))
+			}
+			r.Use(auth.TenantLimits(tenants, tenantLimiter, auditLog))
+
+			r.With(auth.RequirePermission(auth.PermissionAddressSearch)).
+				Post("/address/search", geoController.HandlerAddressSearch())
+			r.With(auth.RequirePermission(auth.PermissionAddressGeocode)).
+				Post("/address/geocode", geoController.HandlerAddressGeocode())
+		})
 
+		// Protected routes also accept personal access tokens. Their scopes
+		// are checked by RequirePermission and RequireScope.
 		r.Group(func(r chi.Router) {
-			r.Use(jwtauth.Verifier(tokenAuth))
-			r.Use(jwtauth.Authenticator(tokenAuth))
+			r.Use(auth.PersonalTokenVerifier(personalTokenService))
+			if sessions != nil {
+				r.Use(sessions.CSRF)
+			}
+			r.Use(auth.Verifier(keyRing, tokenSources...))
+			r.Use(auth.CheckRevoked(denylist))
+			r.Use(auth.Authenticator)
+			r.Use(auth.RejectDisabled(users))
+
+			r.With(auth.RequireScope(auth.PermissionProfileRead)).
+				Get("/me", authController.Me())
+
+			// The account and its credentials are only managed with a login
+			// session.
+			r.Group(func(r chi.Router) {
+				r.Use(auth.RejectPersonalTokens)
+				r.Patch("/me", authController.UpdateProfile())
+				r.Put("/me/password", authController.ChangePassword())
+				r.Post("/logout", authController.Logout())
+				r.Get("/me/mfa", mfaController.Status())
+				r.Post("/me/mfa/totp", mfaController.Enroll())
+				r.Post("/me/mfa/totp/verify", mfaController.Verify())
+				r.Post("/me/mfa/totp/disable", mfaController.Disable())
+				r.Post("/me/mfa/recovery-codes", mfaController.RecoveryCodes())
+				r.Post("/email/verify/resend", verificationController.Resend())
+				r.Get("/api-keys", apiKeyController.List())
+				r.Post("/api-keys", apiKeyController.Create())
+				r.Delete("/api-keys/{id}", apiKeyController.Revoke())
+				r.Get("/me/tokens", personalTokenController.List())
+				r.Post("/me/tokens", personalTokenController.Create())
+				r.Delete("/me/tokens/{id}", personalTokenController.Revoke())
+			})
+
+			r.Route("/admin", func(r chi.Router) {
+				r.With(auth.RequirePermission(auth.PermissionTokensRevoke)).
+					Post("/users/{id}/revoke-tokens", adminController.RevokeUserTokens())
+
+				r.Group(func(r chi.Router) {
+					r.Use(auth.RequirePermission(auth.PermissionUsersManage))
+					r.Get("/users", adminController.ListUsers())
+					r.Get("/users/{id}", adminController.GetUser())
+					r.Delete("/users/{id}", adminController.DeleteUser())
+					r.Post("/users/{id}/disable", adminController.DisableUser())
+					r.Post("/users/{id}/enable", adminController.EnableUser())
+					r.Post("/users/{id}/password-reset", adminController.ForcePasswordReset())
+					r.Put("/users/{id}/roles", adminController.SetUserRoles())
+					r.Get("/lockouts", adminController.ListLockouts())
+					r.Post("/lockouts/unlock", adminController.Unlock())
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(auth.RequirePermission(auth.PermissionTenantsManage))
+					r.Get("/tenants", tenantController.List())
+					r.Post("/tenants", tenantController.Create())
+					r.Get("/tenants/{id}", tenantController.Get())
+					r.Patch("/tenants/{id}", tenantController.Update())
+					r.Delete("/tenants/{id}", tenantController.Delete())
+					r.Put("/users/{id}/tenant", tenantController.SetUserTenant())
+					// Request counters of tenants are published as "tenants".
+					r.Get("/metrics", expvar.Handler().ServeHTTP)
+				})
+
+				if auditEvents != nil {
+					r.With(auth.RequirePermission(auth.PermissionAuditRead)).
+						Get("/audit", auditController.List())
+				}
 
-			// Protected routes
-			r.Post("/address/search", geoController.HandlerAddressSearch())
-			r.Post("/address/geocode", geoController.HandlerAddressGeocode())
+				r.Group(func(r chi.Router) {
+					r.Use(auth.RequirePermission(auth.PermissionKeysManage))
+					r.Get("/keys", adminController.ListKeys())
+					r.Post("/keys/reload", adminController.ReloadKeys())
+					r.Post("/keys/rotate", adminController.RotateKeys())
+				})
+			})
 		})
 	})
 
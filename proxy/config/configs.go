@@ -2,14 +2,89 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	DaDataAPIKey    string
-	DaDataSecretKey string
+	// GeoProvider is the name of the geo provider. GeoSettings holds its
+	// settings, taken from the variables prefixed with the provider name,
+	// e.g. DADATA_API_KEY becomes "api_key".
+	GeoProvider     string
+	GeoSettings     map[string]string
 	JwtSecret       string
+	JwtAlgorithm    string
+	JwtPrivateKey   string
+	JwtKeyID        string
+	JwtKeysDir      string
+	JwtRotation     time.Duration
+	PublicURL       string
+	UserStore       string
+	DatabasePath    string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	JwtIssuer       string
+	JwtAudience     string
+	JwtClockSkew    time.Duration
+	AdminUsernames  []string
+
+	PasswordMinLength     int
+	PasswordRequireUpper  bool
+	PasswordRequireLower  bool
+	PasswordRequireDigit  bool
+	PasswordRequireSymbol bool
+	BreachedPasswordsFile string
+	PasswordHashAlgorithm string
+	BcryptCost            int
+	Argon2Memory          int
+	Argon2Iterations      int
+	Argon2Parallelism     int
+
+	LoginMaxFailures      int
+	LoginMaxFailuresPerIP int
+	LoginLockoutBase      time.Duration
+	LoginLockoutMax       time.Duration
+	LoginFailureReset     time.Duration
+	TrustProxyHeaders     bool
+	AuditLogFile          string
+	AuditSinks            []string
+
+	Mailer           string
+	MailFrom         string
+	MailDir          string
+	SMTPHost         string
+	SMTPPort         int
+	SMTPUsername     string
+	SMTPPassword     string
+	PasswordResetTTL time.Duration
+	PasswordResetURL string
+
+	EmailVerificationRequired       bool
+	EmailVerificationTTL            time.Duration
+	EmailVerificationResendInterval time.Duration
+
+	MFAIssuer       string
+	MFAChallengeTTL time.Duration
+
+	SessionCookies        bool
+	SessionCookieSecure   bool
+	SessionCookieSameSite string
+
+	OIDCIssuer        string
+	OIDCClientID      string
+	OIDCClientSecret  string
+	OIDCRedirectURL   string
+	OIDCScopes        []string
+	OIDCUsernameClaim string
+	OIDCEmailClaim    string
+	OIDCNameClaim     string
+
+	// IntrospectionClients maps the client IDs allowed to call the token
+	// introspection endpoint to their secrets.
+	IntrospectionClients map[string]string
 }
 
 type AuthConfig struct {
@@ -19,24 +94,231 @@ type AuthConfig struct {
 func LoadConfig() *Config {
 	godotenv.Load()
 
+	algorithm := getEnv("JWT_ALGORITHM", "HS256")
 	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		panic("Can not get secret")
+	privateKey := os.Getenv("JWT_PRIVATE_KEY_FILE")
+	keysDir := os.Getenv("JWT_KEYS_DIR")
+	switch algorithm {
+	case "HS256":
+		if secret == "" && keysDir == "" {
+			panic("Can not get secret")
+		}
+	case "RS256", "ES256", "EdDSA":
+		if privateKey == "" && keysDir == "" {
+			panic("JWT_PRIVATE_KEY_FILE or JWT_KEYS_DIR is required for " + algorithm)
+		}
+	default:
+		panic("JWT_ALGORITHM must be one of HS256, RS256, ES256, EdDSA")
 	}
 
-	apiKey := os.Getenv("DADATA_API_KEY")
-	if apiKey == "" {
-		panic("Can not get DADATA_API_KEY")
+	geoProvider := strings.ToLower(getEnv("GEO_PROVIDER", "dadata"))
+
+	userStore := getEnv("USER_STORE", "sqlite")
+	if userStore != "sqlite" && userStore != "memory" {
+		panic("USER_STORE must be either sqlite or memory")
 	}
 
-	dadataSecretKey := os.Getenv("DADATA_SECRET_KEY")
-	if dadataSecretKey == "" {
-		panic("Can not get DADATA_SECRET_KEY")
+	mailer := getEnv("MAILER", "log")
+	switch mailer {
+	case "log", "file":
+	case "smtp":
+		if os.Getenv("SMTP_HOST") == "" {
+			panic("SMTP_HOST is required for MAILER=smtp")
+		}
+	default:
+		panic("MAILER must be one of log, file, smtp")
+	}
+	hashAlgorithm := getEnv("PASSWORD_HASH_ALGORITHM", "argon2id")
+	if hashAlgorithm != "argon2id" && hashAlgorithm != "bcrypt" {
+		panic("PASSWORD_HASH_ALGORITHM must be either argon2id or bcrypt")
+	}
+	bcryptCost := getEnvInt("BCRYPT_COST", 10)
+	if bcryptCost < 4 || bcryptCost > 31 {
+		panic("BCRYPT_COST must be between 4 and 31")
+	}
+	argon2Parallelism := getEnvInt("ARGON2_PARALLELISM", 1)
+	if argon2Parallelism < 1 || argon2Parallelism > 255 {
+		panic("ARGON2_PARALLELISM must be between 1 and 255")
+	}
+	argon2Memory := getEnvInt("ARGON2_MEMORY", 19456)
+	if argon2Memory < 8*argon2Parallelism {
+		panic("ARGON2_MEMORY must be at least 8 KiB per thread")
+	}
+	argon2Iterations := getEnvInt("ARGON2_ITERATIONS", 2)
+	if argon2Iterations < 1 {
+		panic("ARGON2_ITERATIONS must be positive")
+	}
+	publicURL := strings.TrimRight(getEnv("PUBLIC_URL", "http://localhost:8080"), "/")
+
+	sameSite := getEnv("SESSION_COOKIE_SAMESITE", "strict")
+	if sameSite != "strict" && sameSite != "lax" {
+		panic("SESSION_COOKIE_SAMESITE must be either strict or lax")
+	}
+
+	auditSinks := getEnvList("AUDIT_SINKS")
+	if len(auditSinks) == 0 {
+		auditSinks = []string{"json"}
+	}
+	for _, sink := range auditSinks {
+		if sink != "json" && sink != "sqlite" {
+			panic("AUDIT_SINKS must list json and/or sqlite")
+		}
+	}
+
+	oidcIssuer := os.Getenv("OIDC_ISSUER")
+	if oidcIssuer != "" && os.Getenv("OIDC_CLIENT_ID") == "" {
+		panic("OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+	}
+	oidcScopes := getEnvList("OIDC_SCOPES")
+	if len(oidcScopes) == 0 {
+		oidcScopes = []string{"openid", "profile", "email"}
+	}
+
+	introspectionClients := make(map[string]string)
+	for _, client := range getEnvList("INTROSPECTION_CLIENTS") {
+		id, secret, ok := strings.Cut(client, ":")
+		if !ok || id == "" || secret == "" {
+			panic("INTROSPECTION_CLIENTS must list client_id:secret pairs")
+		}
+		introspectionClients[id] = secret
 	}
 
 	return &Config{
-		DaDataAPIKey:    apiKey,
-		DaDataSecretKey: dadataSecretKey,
+		GeoProvider:     geoProvider,
+		GeoSettings:     getEnvWithPrefix(strings.ToUpper(geoProvider) + "_"),
 		JwtSecret:       secret,
+		JwtAlgorithm:    algorithm,
+		JwtPrivateKey:   privateKey,
+		JwtKeyID:        os.Getenv("JWT_KEY_ID"),
+		JwtKeysDir:      keysDir,
+		JwtRotation:     getEnvDuration("JWT_ROTATION_INTERVAL", 0),
+		PublicURL:       publicURL,
+		UserStore:       userStore,
+		DatabasePath:    getEnv("DATABASE_PATH", "data/hugoproxy.db"),
+		AccessTokenTTL:  getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		JwtIssuer:       getEnv("JWT_ISSUER", "hugoproxy"),
+		JwtAudience:     getEnv("JWT_AUDIENCE", "hugoproxy-api"),
+		JwtClockSkew:    getEnvDuration("JWT_CLOCK_SKEW", 30*time.Second),
+		AdminUsernames:  getEnvList("ADMIN_USERNAMES"),
+
+		PasswordMinLength:     getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordRequireUpper:  getEnvBool("PASSWORD_REQUIRE_UPPER", true),
+		PasswordRequireLower:  getEnvBool("PASSWORD_REQUIRE_LOWER", true),
+		PasswordRequireDigit:  getEnvBool("PASSWORD_REQUIRE_DIGIT", true),
+		PasswordRequireSymbol: getEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+		BreachedPasswordsFile: os.Getenv("BREACHED_PASSWORDS_FILE"),
+		PasswordHashAlgorithm: hashAlgorithm,
+		BcryptCost:            bcryptCost,
+		Argon2Memory:          argon2Memory,
+		Argon2Iterations:      argon2Iterations,
+		Argon2Parallelism:     argon2Parallelism,
+
+		LoginMaxFailures:      getEnvInt("LOGIN_MAX_FAILURES", 5),
+		LoginMaxFailuresPerIP: getEnvInt("LOGIN_MAX_FAILURES_PER_IP", 20),
+		LoginLockoutBase:      getEnvDuration("LOGIN_LOCKOUT_BASE", time.Minute),
+		LoginLockoutMax:       getEnvDuration("LOGIN_LOCKOUT_MAX", time.Hour),
+		LoginFailureReset:     getEnvDuration("LOGIN_FAILURE_RESET", 24*time.Hour),
+		TrustProxyHeaders:     getEnvBool("TRUST_PROXY_HEADERS", false),
+		AuditLogFile:          os.Getenv("AUDIT_LOG_FILE"),
+		AuditSinks:            auditSinks,
+
+		Mailer:           mailer,
+		MailFrom:         getEnv("MAIL_FROM", "HugoProxy <no-reply@localhost>"),
+		MailDir:          getEnv("MAIL_DIR", "data/mail"),
+		SMTPHost:         os.Getenv("SMTP_HOST"),
+		SMTPPort:         getEnvInt("SMTP_PORT", 587),
+		SMTPUsername:     os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:     os.Getenv("SMTP_PASSWORD"),
+		PasswordResetTTL: getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		PasswordResetURL: getEnv("PASSWORD_RESET_URL", publicURL+"/reset-password"),
+
+		EmailVerificationRequired:       getEnvBool("EMAIL_VERIFICATION_REQUIRED", false),
+		EmailVerificationTTL:            getEnvDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+		EmailVerificationResendInterval: getEnvDuration("EMAIL_VERIFICATION_RESEND_INTERVAL", time.Minute),
+
+		MFAIssuer:       getEnv("MFA_ISSUER", "HugoProxy"),
+		MFAChallengeTTL: getEnvDuration("MFA_CHALLENGE_TTL", 5*time.Minute),
+
+		SessionCookies:        getEnvBool("SESSION_COOKIES", false),
+		SessionCookieSecure:   getEnvBool("SESSION_COOKIE_SECURE", true),
+		SessionCookieSameSite: sameSite,
+
+		OIDCIssuer:        oidcIssuer,
+		OIDCClientID:      os.Getenv("OIDC_CLIENT_ID"),
+		OIDCClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:   getEnv("OIDC_REDIRECT_URL", publicURL+"/api/oidc/callback"),
+		OIDCScopes:        oidcScopes,
+		OIDCUsernameClaim: getEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
+		OIDCEmailClaim:    getEnv("OIDC_EMAIL_CLAIM", "email"),
+		OIDCNameClaim:     getEnv("OIDC_NAME_CLAIM", "name"),
+
+		IntrospectionClients: introspectionClients,
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvList(key string) []string {
+	var res []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// getEnvWithPrefix returns the variables starting with prefix, keyed by the
+// rest of their name in lower case.
+func getEnvWithPrefix(prefix string) map[string]string {
+	res := make(map[string]string)
+	for _, item := range os.Environ() {
+		key, value, _ := strings.Cut(item, "=")
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+			res[strings.ToLower(key[len(prefix):])] = value
+		}
+	}
+	return res
+}
+
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		panic("Can not parse " + key + " as integer")
+	}
+	return n
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		panic("Can not parse " + key + " as positive duration")
+	}
+	return d
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		panic("Can not parse " + key + " as boolean")
 	}
+	return b
 }
@@ -0,0 +1,178 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	EventUserRegister   = "user.register"
+	EventUserDisable    = "user.disable"
+	EventUserEnable     = "user.enable"
+	EventUserDelete     = "user.delete"
+	EventLoginSuccess   = "login.success"
+	EventLoginFailure   = "login.failure"
+	EventLoginLockout   = "login.lockout"
+	EventLoginUnlock    = "login.unlock"
+	EventTokenRefresh   = "token.refresh"
+	EventTokenReuse     = "token.reuse"
+	EventTokenRevoke    = "token.revoke"
+	EventPasswordChange = "password.change"
+	EventPasswordReset  = "password.reset"
+	EventPasswordForced = "password.reset_forced"
+	EventRoleChange     = "role.change"
+	EventUserTenant     = "user.tenant"
+	EventTenantCreate   = "tenant.create"
+	EventTenantUpdate   = "tenant.update"
+	EventTenantDelete   = "tenant.delete"
+	EventTenantQuota    = "tenant.quota_exceeded"
+
+	EventPersonalTokenCreate = "personal_token.create"
+	EventPersonalTokenRevoke = "personal_token.revoke"
+)
+
+// Event is a single security relevant action. Details holds event specific
+// fields. IP, UserAgent and RequestID are taken from the request the event
+// was recorded in unless they are set explicitly.
+type Event struct {
+	ID        int64             `json:"id,omitempty"`
+	Time      time.Time         `json:"time"`
+	Type      string            `json:"type"`
+	UserID    int64             `json:"user_id,omitempty"`
+	Username  string            `json:"username,omitempty"`
+	TenantID  int64             `json:"tenant_id,omitempty"`
+	IP        string            `json:"ip,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// Logger is a sink events are appended to. Sinks never change or delete
+// recorded events.
+type Logger interface {
+	Record(ctx context.Context, event Event) error
+}
+
+// Filter selects events for Query. Zero fields match every event.
+type Filter struct {
+	Type      string
+	UserID    int64
+	Username  string
+	TenantID  int64
+	IP        string
+	RequestID string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Offset    int
+}
+
+// Querier is implemented by sinks that can search the recorded events.
+type Querier interface {
+	// Query returns a page of events, newest first, together with the
+	// number of events matching the filter.
+	Query(ctx context.Context, filter Filter) ([]Event, int, error)
+}
+
+// MultiLogger records every event in all of its sinks.
+type MultiLogger []Logger
+
+func (m MultiLogger) Record(ctx context.Context, event Event) error {
+	var errs []error
+	for _, logger := range m {
+		if err := logger.Record(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type requestContextKey struct{}
+
+type requestInfo struct {
+	ip        string
+	userAgent string
+	requestID string
+}
+
+// Middleware remembers the client address, user agent and request ID, so
+// events recorded while handling the request carry them. It must be placed
+// after middleware.RequestID and, if used, middleware.RealIP.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		info := requestInfo{
+			ip:        ip,
+			userAgent: r.UserAgent(),
+			requestID: middleware.GetReqID(r.Context()),
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestContextKey{}, info)))
+	})
+}
+
+// complete sets the time and the request fields of the event that are not
+// set yet.
+func complete(ctx context.Context, event Event) Event {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	info, _ := ctx.Value(requestContextKey{}).(requestInfo)
+	if event.IP == "" {
+		event.IP = info.ip
+	}
+	if event.UserAgent == "" {
+		event.UserAgent = info.userAgent
+	}
+	if event.RequestID == "" {
+		event.RequestID = info.requestID
+	}
+	return event
+}
+
+// JSONLogger appends every event as one JSON line to w.
+type JSONLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONLogger(w io.Writer) *JSONLogger {
+	return &JSONLogger{w: w}
+}
+
+// OpenFile returns a JSONLogger appending to the file at path, creating it and
+// its directory if needed.
+func OpenFile(path string) (*JSONLogger, *os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewJSONLogger(f), f, nil
+}
+
+func (l *JSONLogger) Record(ctx context.Context, event Event) error {
+	data, err := json.Marshal(complete(ctx, event))
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(data, '\n'))
+	return err
+}
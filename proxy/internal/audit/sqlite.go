@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"test/internal/database"
+)
+
+var migrations = []string{
+	`CREATE TABLE audit_events (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		time       TIMESTAMP NOT NULL,
+		type       TEXT NOT NULL,
+		user_id    INTEGER,
+		username   TEXT NOT NULL DEFAULT '',
+		ip         TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		request_id TEXT NOT NULL DEFAULT '',
+		details    TEXT NOT NULL DEFAULT '{}'
+	)`,
+	`CREATE INDEX audit_events_time ON audit_events (time)`,
+	`CREATE INDEX audit_events_user_id ON audit_events (user_id)`,
+	`CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+	BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END`,
+	`CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+	BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END`,
+	`ALTER TABLE audit_events ADD COLUMN tenant_id INTEGER`,
+}
+
+// SQLiteLogger stores events in the audit_events table. The table rejects
+// updates and deletes.
+type SQLiteLogger struct {
+	db *sql.DB
+}
+
+func NewSQLiteLogger(db *sql.DB) (*SQLiteLogger, error) {
+	if err := database.Migrate(db, "audit", migrations); err != nil {
+		return nil, err
+	}
+	return &SQLiteLogger{db: db}, nil
+}
+
+func (l *SQLiteLogger) Record(ctx context.Context, event Event) error {
+	event = complete(ctx, event)
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		return err
+	}
+	var userID, tenantID sql.NullInt64
+	if event.UserID != 0 {
+		userID = sql.NullInt64{Int64: event.UserID, Valid: true}
+	}
+	if event.TenantID != 0 {
+		tenantID = sql.NullInt64{Int64: event.TenantID, Valid: true}
+	}
+
+	// The request context may already be canceled, the event has to be
+	// stored anyway.
+	_, err = l.db.ExecContext(context.WithoutCancel(ctx),
+		`INSERT INTO audit_events (time, type, user_id, username, tenant_id, ip, user_agent, request_id, details) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.Time.UTC(), event.Type, userID, event.Username, tenantID, event.IP, event.UserAgent, event.RequestID, string(details),
+	)
+	return err
+}
+
+func (l *SQLiteLogger) Query(ctx context.Context, filter Filter) ([]Event, int, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+	if filter.Type != "" {
+		add(`type = ?`, filter.Type)
+	}
+	if filter.UserID != 0 {
+		add(`user_id = ?`, filter.UserID)
+	}
+	if filter.Username != "" {
+		add(`username = ? COLLATE NOCASE`, filter.Username)
+	}
+	if filter.TenantID != 0 {
+		add(`tenant_id = ?`, filter.TenantID)
+	}
+	if filter.IP != "" {
+		add(`ip = ?`, filter.IP)
+	}
+	if filter.RequestID != "" {
+		add(`request_id = ?`, filter.RequestID)
+	}
+	if !filter.From.IsZero() {
+		add(`time >= ?`, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		add(`time < ?`, filter.To.UTC())
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+
+	var total int
+	if err := l.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_events`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := l.db.QueryContext(ctx,
+		`SELECT id, time, type, user_id, username, tenant_id, ip, user_agent, request_id, details FROM audit_events`+where+
+			` ORDER BY id DESC LIMIT ? OFFSET ?`,
+		append(args, filter.Limit, filter.Offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var event Event
+		var userID, tenantID sql.NullInt64
+		var details string
+		err := rows.Scan(&event.ID, &event.Time, &event.Type, &userID, &event.Username, &tenantID, &event.IP, &event.UserAgent, &event.RequestID, &details)
+		if err != nil {
+			return nil, 0, err
+		}
+		event.UserID = userID.Int64
+		event.TenantID = tenantID.Int64
+		if err := json.Unmarshal([]byte(details), &event.Details); err != nil {
+			return nil, 0, err
+		}
+		event.Time = event.Time.In(time.UTC)
+		events = append(events, event)
+	}
+	return events, total, rows.Err()
+}
@@ -0,0 +1,520 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"test/internal/audit"
+	"test/internal/responder"
+)
+
+type AdminController struct {
+	users  UserRepository
+	roles  *RoleService
+	tokens *TokenService
+	keys   *KeyRing
+	guard  *LoginGuard
+	mfa    *MFAService
+	resets *PasswordResetService
+	audit  audit.Logger
+}
+
+func NewAdminController(users UserRepository, roles *RoleService, tokens *TokenService, keys *KeyRing, guard *LoginGuard, mfa *MFAService, resets *PasswordResetService, auditLog audit.Logger) *AdminController {
+	return &AdminController{
+		users:  users,
+		roles:  roles,
+		tokens: tokens,
+		keys:   keys,
+		guard:  guard,
+		mfa:    mfa,
+		resets: resets,
+		audit:  auditLog,
+	}
+}
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// ListUsers godoc
+// @Summary Список пользователей
+// @Description Возвращает страницу пользователей, упорядоченных по ID. Параметр q ищет по части имени пользователя, отображаемого имени или email без учета регистра
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param q query string false "Строка поиска"
+// @Param page query int false "Номер страницы, начиная с 1" default(1)
+// @Param per_page query int false "Размер страницы, не больше 100" default(20)
+// @Success 200 {object} AdminUserListResponse "Страница пользователей"
+// @Failure 400 {object} ErrorResponse "Некорректные параметры страницы"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/users [get]
+func (c *AdminController) ListUsers() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		page, err := positiveQueryInt(query.Get("page"), 1)
+		if err != nil {
+			responder.ErrorBadRequest(w, errors.New("page must be a positive integer"))
+			return
+		}
+		perPage, err := positiveQueryInt(query.Get("per_page"), defaultPerPage)
+		if err != nil || perPage > maxPerPage {
+			responder.ErrorBadRequest(w, fmt.Errorf("per_page must be between 1 and %d", maxPerPage))
+			return
+		}
+
+		users, total, err := c.users.List(r.Context(), UserFilter{
+			Query:  strings.TrimSpace(query.Get("q")),
+			Limit:  perPage,
+			Offset: (page - 1) * perPage,
+		})
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		res := AdminUserListResponse{
+			Users:   make([]AdminUserResponse, 0, len(users)),
+			Total:   total,
+			Page:    page,
+			PerPage: perPage,
+		}
+		for _, user := range users {
+			item, err := adminUserResponse(r.Context(), c.roles, c.mfa, user)
+			if err != nil {
+				responder.ErrorInternal(w, err)
+				return
+			}
+			res.Users = append(res.Users, item)
+		}
+		responder.OutputJSON(w, res)
+	}
+}
+
+func positiveQueryInt(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err == nil && n < 1 {
+		err = errors.New("must be positive")
+	}
+	return n, err
+}
+
+// GetUser godoc
+// @Summary Пользователь
+// @Description Возвращает профиль пользователя, его роли, состояние двухфакторной аутентификации и время отключения
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} AdminUserResponse "Пользователь"
+// @Failure 400 {object} ErrorResponse "Некорректный ID"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 404 {object} ErrorResponse "Пользователь не найден"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/users/{id} [get]
+func (c *AdminController) GetUser() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := userFromPath(w, r, c.users)
+		if !ok {
+			return
+		}
+		outputAdminUser(w, r, c.roles, c.mfa, user)
+	}
+}
+
+// DisableUser godoc
+// @Summary Отключение учетной записи
+// @Description Запрещает пользователю вход и отзывает все его токены. API ключи пользователя перестают приниматься. Отключить собственную учетную запись нельзя
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} AdminUserResponse "Учетная запись отключена"
+// @Failure 400 {object} ErrorResponse "Некорректный ID или попытка отключить себя"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 404 {object} ErrorResponse "Пользователь не найден"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/disable [post]
+func (c *AdminController) DisableUser() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := c.otherUserFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		if user.DisabledAt == nil {
+			now := time.Now().UTC()
+			user.DisabledAt = &now
+			if err := c.users.Update(r.Context(), user); err != nil {
+				responder.ErrorInternal(w, err)
+				return
+			}
+			recordAdminAction(r, c.audit, audit.EventUserDisable, user, nil)
+		}
+		if err := c.tokens.RevokeAllForUser(r.Context(), user.ID); err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		outputAdminUser(w, r, c.roles, c.mfa, user)
+	}
+}
+
+// EnableUser godoc
+// @Summary Включение учетной записи
+// @Description Снова разрешает вход отключенному пользователю. Отозванные при отключении токены остаются недействительными
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} AdminUserResponse "Учетная запись включена"
+// @Failure 400 {object} ErrorResponse "Некорректный ID"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 404 {object} ErrorResponse "Пользователь не найден"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/enable [post]
+func (c *AdminController) EnableUser() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := userFromPath(w, r, c.users)
+		if !ok {
+			return
+		}
+
+		if user.DisabledAt != nil {
+			user.DisabledAt = nil
+			if err := c.users.Update(r.Context(), user); err != nil {
+				responder.ErrorInternal(w, err)
+				return
+			}
+			recordAdminAction(r, c.audit, audit.EventUserEnable, user, nil)
+		}
+
+		outputAdminUser(w, r, c.roles, c.mfa, user)
+	}
+}
+
+// ForcePasswordReset godoc
+// @Summary Принудительная смена пароля
+// @Description Удаляет пароль пользователя, отзывает все его токены и отправляет на email ссылку для установки нового пароля. До перехода по ссылке вход по паролю невозможен
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 204 "Пароль сброшен, письмо отправлено"
+// @Failure 400 {object} ErrorResponse "Некорректный ID или у пользователя нет email"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 404 {object} ErrorResponse "Пользователь не найден"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/password-reset [post]
+func (c *AdminController) ForcePasswordReset() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := userFromPath(w, r, c.users)
+		if !ok {
+			return
+		}
+
+		err := c.resets.ForceReset(r.Context(), user)
+		if errors.Is(err, ErrUserHasNoEmail) {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		recordAdminAction(r, c.audit, audit.EventPasswordForced, user, nil)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// SetUserRoles godoc
+// @Summary Назначение ролей
+// @Description Заменяет роли пользователя переданным списком и отзывает его токены, чтобы новые права вступили в силу. API ключи и персональные токены не отзываются: их права вычисляются по текущим ролям при каждом запросе. Пользователи из ADMIN_USERNAMES получают роль admin обратно при следующем запуске. Менять собственные роли нельзя
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param request body SetRolesRequest true "Новые роли"
+// @Success 200 {object} AdminUserResponse "Роли назначены"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос, неизвестная роль или попытка изменить свои роли"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 404 {object} ErrorResponse "Пользователь не найден"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/roles [put]
+func (c *AdminController) SetUserRoles() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data SetRolesRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+		if data.Roles == nil {
+			responder.ErrorBadRequest(w, errors.New("roles is required"))
+			return
+		}
+
+		user, ok := c.otherUserFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		before, _, err := c.roles.Resolve(r.Context(), user.ID)
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		err = c.roles.SetRoles(r.Context(), user.ID, data.Roles)
+		if errors.Is(err, ErrRoleNotFound) {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		recordAdminAction(r, c.audit, audit.EventRoleChange, user, map[string]string{
+			"before": strings.Join(before, ","),
+			"after":  strings.Join(data.Roles, ","),
+		})
+		if err := c.tokens.RevokeAllForUser(r.Context(), user.ID); err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		outputAdminUser(w, r, c.roles, c.mfa, user)
+	}
+}
+
+// DeleteUser godoc
+// @Summary Удаление пользователя
+// @Description Отзывает все токены пользователя и удаляет его вместе с ролями, API ключами и настройками двухфакторной аутентификации. Удалить собственную учетную запись нельзя
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 204 "Пользователь удален"
+// @Failure 400 {object} ErrorResponse "Некорректный ID или попытка удалить себя"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 404 {object} ErrorResponse "Пользователь не найден"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/users/{id} [delete]
+func (c *AdminController) DeleteUser() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := c.otherUserFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		if err := c.tokens.RevokeAllForUser(r.Context(), user.ID); err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		err := c.users.Delete(r.Context(), user.ID)
+		if errors.Is(err, ErrUserNotFound) {
+			responder.ErrorNotFound(w, err)
+			return
+		}
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		recordAdminAction(r, c.audit, audit.EventUserDelete, user, nil)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RevokeUserTokens godoc
+// @Summary Отзыв всех токенов пользователя
+// @Description Делает недействительными все выданные пользователю access и refresh токены, API ключи и персональные токены. Доступно только администраторам
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 204 "Токены отозваны"
+// @Failure 400 {object} ErrorResponse "Некорректный ID"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 404 {object} ErrorResponse "Пользователь не найден"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/revoke-tokens [post]
+func (c *AdminController) RevokeUserTokens() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := userFromPath(w, r, c.users)
+		if !ok {
+			return
+		}
+
+		if err := c.tokens.RevokeEverything(r.Context(), user.ID); err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// otherUserFromPath works like userFromPath but refuses the admin's own
+// account, so admins cannot lock themselves out.
+func (c *AdminController) otherUserFromPath(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	user, ok := userFromPath(w, r, c.users)
+	if !ok {
+		return nil, false
+	}
+	claims, _ := ClaimsFromContext(r.Context())
+	if user.ID == claims.UserID() {
+		responder.ErrorBadRequest(w, errors.New("admins cannot change their own account here"))
+		return nil, false
+	}
+	return user, true
+}
+
+// ListLockouts godoc
+// @Summary Заблокированные попытки входа
+// @Description Возвращает имена пользователей и IP адреса, вход для которых сейчас заблокирован
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} Lockout
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Router /admin/lockouts [get]
+func (c *AdminController) ListLockouts() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		responder.OutputJSON(w, c.guard.Lockouts())
+	}
+}
+
+// Unlock godoc
+// @Summary Снятие блокировки входа
+// @Description Сбрасывает счетчик неудачных попыток входа для имени пользователя (kind=username) или IP адреса (kind=ip)
+// @Tags admin
+// @Accept json
+// @Security BearerAuth
+// @Param request body UnlockRequest true "Что разблокировать"
+// @Success 204 "Блокировка снята"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 404 {object} ErrorResponse "Неудачных попыток не найдено"
+// @Router /admin/lockouts/unlock [post]
+func (c *AdminController) Unlock() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data UnlockRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+		if data.Kind != LockoutUsername && data.Kind != LockoutIP {
+			responder.ErrorBadRequest(w, errors.New("kind must be either username or ip"))
+			return
+		}
+		if data.Subject == "" {
+			responder.ErrorBadRequest(w, errors.New("subject is required"))
+			return
+		}
+
+		claims, _ := ClaimsFromContext(r.Context())
+		if !c.guard.Unlock(r.Context(), data.Kind, data.Subject, claims.Username) {
+			responder.ErrorNotFound(w, errors.New("no failed logins recorded"))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ListKeys godoc
+// @Summary Ключи подписи токенов
+// @Description Возвращает ключи подписи с их статусом: pending (опубликован, но ещё не подписывает), active (подписывает новые токены), deactivated (только проверяет ранее выданные токены до retires_at)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} KeyInfo
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Router /admin/keys [get]
+func (c *AdminController) ListKeys() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		responder.OutputJSON(w, c.keys.Keys())
+	}
+}
+
+// ReloadKeys godoc
+// @Summary Перечитать ключи подписи
+// @Description Перечитывает каталог JWT_KEYS_DIR без перезапуска сервиса. Новые файлы ключей добавляются как pending
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} KeyInfo
+// @Failure 400 {object} ErrorResponse "Каталог ключей не настроен"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/keys/reload [post]
+func (c *AdminController) ReloadKeys() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.changeKeys(w, c.keys.Reload)
+	}
+}
+
+// RotateKeys godoc
+// @Summary Ротация ключа подписи
+// @Description Делает подписывающим следующий pending ключ (или создаёт новый). Прежний ключ продолжает проверять выданные им токены
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} KeyInfo
+// @Failure 400 {object} ErrorResponse "Каталог ключей не настроен"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/keys/rotate [post]
+func (c *AdminController) RotateKeys() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.changeKeys(w, c.keys.Rotate)
+	}
+}
+
+func (c *AdminController) changeKeys(w http.ResponseWriter, change func() error) {
+	if !c.keys.Dynamic() {
+		responder.ErrorBadRequest(w, errors.New("JWT_KEYS_DIR is not configured"))
+		return
+	}
+	if err := change(); err != nil {
+		responder.ErrorInternal(w, err)
+		return
+	}
+	responder.OutputJSON(w, c.keys.Keys())
+}
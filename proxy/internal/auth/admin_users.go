@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"test/internal/audit"
+	"test/internal/responder"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// userFromPath loads the user with the id in the URL or responds with an
+// error.
+func userFromPath(w http.ResponseWriter, r *http.Request, users UserRepository) (*User, bool) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		responder.ErrorBadRequest(w, errors.New("invalid user id"))
+		return nil, false
+	}
+
+	user, err := users.GetByID(r.Context(), userID)
+	if errors.Is(err, ErrUserNotFound) {
+		responder.ErrorNotFound(w, err)
+		return nil, false
+	}
+	if err != nil {
+		responder.ErrorInternal(w, err)
+		return nil, false
+	}
+	return user, true
+}
+
+// recordAdminAction writes an admin action on the user to the audit log,
+// noting the admin in the "by" detail.
+func recordAdminAction(r *http.Request, logger audit.Logger, eventType string, user *User, details map[string]string) {
+	if details == nil {
+		details = map[string]string{}
+	}
+	claims, _ := ClaimsFromContext(r.Context())
+	details["by"] = claims.Username
+	recordAudit(r.Context(), logger, userEvent(eventType, user, details))
+}
+
+// outputAdminUser responds with the user as the user management endpoints
+// show it.
+func outputAdminUser(w http.ResponseWriter, r *http.Request, roles *RoleService, mfa *MFAService, user *User) {
+	res, err := adminUserResponse(r.Context(), roles, mfa, user)
+	if err != nil {
+		responder.ErrorInternal(w, err)
+		return
+	}
+	responder.OutputJSON(w, res)
+}
+
+func adminUserResponse(ctx context.Context, roles *RoleService, mfa *MFAService, user *User) (AdminUserResponse, error) {
+	userRoles, _, err := roles.Resolve(ctx, user.ID)
+	if err != nil {
+		return AdminUserResponse{}, err
+	}
+	mfaEnabled, err := mfa.Enabled(ctx, user.ID)
+	if err != nil {
+		return AdminUserResponse{}, err
+	}
+	return AdminUserResponse{
+		UserProfile: NewUserProfile(user),
+		Roles:       userRoles,
+		MFAEnabled:  mfaEnabled,
+		DisabledAt:  user.DisabledAt,
+	}, nil
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidAPIKey  = errors.New("api key is invalid or revoked")
+)
+
+// APIKey is a credential for machine clients. It is sent in the X-API-Key
+// header and does not expire.
+type APIKey = Credential
+
+var apiKeyKind = credentialKind{
+	prefix:   "hp",
+	name:     "api key",
+	notFound: ErrAPIKeyNotFound,
+	invalid:  ErrInvalidAPIKey,
+}
+
+// APIKeyService creates API keys and authenticates requests made with them.
+type APIKeyService struct {
+	credentialStore
+}
+
+func NewAPIKeyService(keys CredentialRepository, users UserRepository, roles *RoleService) *APIKeyService {
+	return &APIKeyService{credentialStore{kind: apiKeyKind, repo: keys, users: users, roles: roles}}
+}
+
+// Create issues a key with the given scopes and returns it together with the
+// raw key, which is not stored and can not be shown again.
+func (s *APIKeyService) Create(ctx context.Context, userID int64, name string, scopes []string) (*APIKey, string, error) {
+	return s.create(ctx, userID, name, scopes, nil)
+}
+
+// Authenticate resolves a raw key to the claims of its owner. The key only
+// grants those of its scopes that the owner's roles still allow.
+func (s *APIKeyService) Authenticate(ctx context.Context, raw string) (*Claims, error) {
+	key, claims, err := s.authenticate(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	claims.APIKeyID = key.ID
+	return claims, nil
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"test/internal/responder"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const maxAPIKeyNameLength = 64
+
+type APIKeyController struct {
+	keys *APIKeyService
+}
+
+func NewAPIKeyController(keys *APIKeyService) *APIKeyController {
+	return &APIKeyController{
+		keys: keys,
+	}
+}
+
+// Create godoc
+// @Summary Создание API ключа
+// @Description Создает API ключ для машинных клиентов. Ключ возвращается только один раз. Scopes должны входить в разрешения текущего пользователя
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateAPIKeyRequest true "Название и разрешения ключа"
+// @Success 200 {object} APIKeyResponse "Ключ создан"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос или ошибки валидации полей"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /api-keys [post]
+func (c *APIKeyController) Create() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data CreateAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+
+		claims, _ := ClaimsFromContext(r.Context())
+		data.Name = strings.TrimSpace(data.Name)
+		errs := ValidationErrors{}
+		if data.Name == "" {
+			errs["name"] = "is required"
+		} else if len(data.Name) > maxAPIKeyNameLength {
+			errs["name"] = "must be at most " + strconv.Itoa(maxAPIKeyNameLength) + " characters"
+		}
+		if len(data.Scopes) == 0 {
+			errs["scopes"] = "at least one scope is required"
+		}
+		for _, scope := range data.Scopes {
+			if !claims.HasPermission(scope) {
+				errs["scopes"] = "scope " + scope + " is not granted to you"
+				break
+			}
+		}
+		if len(errs) > 0 {
+			responder.ErrorValidation(w, errs, errs)
+			return
+		}
+
+		key, raw, err := c.keys.Create(r.Context(), claims.UserID(), data.Name, data.Scopes)
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		res := NewAPIKeyResponse(key)
+		res.Key = raw
+		responder.OutputJSON(w, res)
+	}
+}
+
+// List godoc
+// @Summary Список API ключей
+// @Description Возвращает API ключи текущего пользователя, включая отозванные. Сами ключи не возвращаются
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} APIKeyResponse
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /api-keys [get]
+func (c *APIKeyController) List() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := ClaimsFromContext(r.Context())
+		keys, err := c.keys.List(r.Context(), claims.UserID())
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		res := make([]APIKeyResponse, 0, len(keys))
+		for i := range keys {
+			res = append(res, NewAPIKeyResponse(&keys[i]))
+		}
+		responder.OutputJSON(w, res)
+	}
+}
+
+// Revoke godoc
+// @Summary Отзыв API ключа
+// @Description Отзывает API ключ текущего пользователя. Запросы с этим ключом сразу перестают приниматься
+// @Tags api-keys
+// @Security BearerAuth
+// @Param id path int true "ID ключа"
+// @Success 204 "Ключ отозван"
+// @Failure 400 {object} ErrorResponse "Некорректный ID"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 404 {object} ErrorResponse "Ключ не найден"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /api-keys/{id} [delete]
+func (c *APIKeyController) Revoke() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			responder.ErrorBadRequest(w, errors.New("invalid api key id"))
+			return
+		}
+
+		claims, _ := ClaimsFromContext(r.Context())
+		if err := c.keys.Revoke(r.Context(), claims.UserID(), id); err != nil {
+			if errors.Is(err, ErrAPIKeyNotFound) {
+				responder.ErrorNotFound(w, err)
+				return
+			}
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
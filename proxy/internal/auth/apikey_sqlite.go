@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"database/sql"
+
+	"test/internal/database"
+)
+
+var apiKeyMigrations = []string{
+	`CREATE TABLE api_keys (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id      INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name         TEXT NOT NULL,
+		prefix       TEXT NOT NULL UNIQUE,
+		key_hash     TEXT NOT NULL,
+		scopes       TEXT NOT NULL,
+		created_at   TIMESTAMP NOT NULL,
+		last_used_at TIMESTAMP,
+		revoked_at   TIMESTAMP
+	)`,
+	`CREATE INDEX api_keys_user_id ON api_keys (user_id)`,
+	// API keys share the columns of the other credential tables.
+	`ALTER TABLE api_keys RENAME COLUMN key_hash TO secret_hash`,
+	`ALTER TABLE api_keys ADD COLUMN expires_at TIMESTAMP`,
+}
+
+func NewSQLiteAPIKeyRepository(db *sql.DB) (*SQLiteCredentialRepository, error) {
+	if err := database.Migrate(db, "api_keys", apiKeyMigrations); err != nil {
+		return nil, err
+	}
+	return &SQLiteCredentialRepository{db: db, table: "api_keys"}, nil
+}
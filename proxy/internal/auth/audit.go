@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"context"
+	"log"
+
+	"test/internal/audit"
+)
+
+// recordAudit writes the event to the audit log. A failure is only logged, so
+// it never fails the request that caused the event.
+func recordAudit(ctx context.Context, logger audit.Logger, event audit.Event) {
+	if logger == nil {
+		return
+	}
+	if err := logger.Record(ctx, event); err != nil {
+		log.Println("write audit log:", err)
+	}
+}
+
+// userEvent returns an event about the user, attributed to the user's
+// tenant.
+func userEvent(eventType string, user *User, details map[string]string) audit.Event {
+	return audit.Event{
+		Type:     eventType,
+		UserID:   user.ID,
+		Username: user.Username,
+		TenantID: user.TenantID,
+		Details:  details,
+	}
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"test/internal/audit"
+	"test/internal/responder"
+)
+
+type AuditController struct {
+	events audit.Querier
+}
+
+func NewAuditController(events audit.Querier) *AuditController {
+	return &AuditController{events: events}
+}
+
+// List godoc
+// @Summary Журнал аудита
+// @Description Возвращает события журнала аудита, начиная с новых. Все фильтры необязательны и объединяются через И. Время from и to задается в формате RFC 3339, to не включается
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param type query string false "Тип события, например login.failure"
+// @Param user_id query int false "ID пользователя"
+// @Param username query string false "Имя пользователя"
+// @Param tenant_id query int false "ID организации"
+// @Param ip query string false "IP адрес клиента"
+// @Param request_id query string false "ID запроса"
+// @Param from query string false "Начало периода" format(date-time)
+// @Param to query string false "Конец периода" format(date-time)
+// @Param page query int false "Номер страницы, начиная с 1" default(1)
+// @Param per_page query int false "Размер страницы, не больше 100" default(20)
+// @Success 200 {object} AuditEventListResponse "Страница событий"
+// @Failure 400 {object} ErrorResponse "Некорректные фильтры"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/audit [get]
+func (c *AuditController) List() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		page, err := positiveQueryInt(query.Get("page"), 1)
+		if err != nil {
+			responder.ErrorBadRequest(w, errors.New("page must be a positive integer"))
+			return
+		}
+		perPage, err := positiveQueryInt(query.Get("per_page"), defaultPerPage)
+		if err != nil || perPage > maxPerPage {
+			responder.ErrorBadRequest(w, fmt.Errorf("per_page must be between 1 and %d", maxPerPage))
+			return
+		}
+
+		filter := audit.Filter{
+			Type:      query.Get("type"),
+			Username:  query.Get("username"),
+			IP:        query.Get("ip"),
+			RequestID: query.Get("request_id"),
+			Limit:     perPage,
+			Offset:    (page - 1) * perPage,
+		}
+		for name, target := range map[string]*int64{"user_id": &filter.UserID, "tenant_id": &filter.TenantID} {
+			if value := query.Get(name); value != "" {
+				if *target, err = strconv.ParseInt(value, 10, 64); err != nil {
+					responder.ErrorBadRequest(w, fmt.Errorf("invalid %s", name))
+					return
+				}
+			}
+		}
+		for name, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+			if value := query.Get(name); value != "" {
+				if *target, err = time.Parse(time.RFC3339, value); err != nil {
+					responder.ErrorBadRequest(w, fmt.Errorf("%s must be an RFC 3339 time", name))
+					return
+				}
+			}
+		}
+
+		events, total, err := c.events.Query(r.Context(), filter)
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		responder.OutputJSON(w, AuditEventListResponse{
+			Events:  events,
+			Total:   total,
+			Page:    page,
+			PerPage: perPage,
+		})
+	}
+}
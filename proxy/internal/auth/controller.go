@@ -1,103 +1,653 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"io"
+	"log"
 	"net/http"
+	"strings"
 
+	"test/internal/audit"
 	"test/internal/responder"
-
-	"github.com/go-chi/jwtauth/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthController struct {
-	tokenAuth *jwtauth.JWTAuth
-	user      *User
+	tokens *TokenService
+	users  UserRepository
+	roles  *RoleService
+	policy *PasswordPolicy
+	hasher *PasswordHasher
+	guard  *LoginGuard
+	// verification is nil unless new accounts have to verify their email.
+	verification *EmailVerificationService
+	// sessions is nil unless browser sessions in cookies are enabled.
+	sessions *Sessions
+	mfa      *MFAService
+	audit    audit.Logger
 }
 
-func NewAuthController(tokenAuth *jwtauth.JWTAuth, user *User) *AuthController {
+func NewAuthController(tokens *TokenService, users UserRepository, roles *RoleService, policy *PasswordPolicy, hasher *PasswordHasher, guard *LoginGuard, verification *EmailVerificationService, sessions *Sessions, mfa *MFAService, auditLog audit.Logger) *AuthController {
 	return &AuthController{
-		tokenAuth: tokenAuth,
-		user:      user,
+		tokens:       tokens,
+		users:        users,
+		roles:        roles,
+		policy:       policy,
+		hasher:       hasher,
+		guard:        guard,
+		verification: verification,
+		sessions:     sessions,
+		mfa:          mfa,
+		audit:        auditLog,
 	}
 }
 
 // Register godoc
 // @Summary Регистрация нового пользователя
-// @Description Создает нового пользователя и возвращает JWT токен для аутентификации
+// @Description Создает нового пользователя и возвращает JWT токен для аутентификации. Если включено подтверждение email, на адрес отправляется ссылка, а поиск адресов доступен только после перехода по ней
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param request body User true "Данные пользователя для регистрации"
-// @Success 200 {object} TokenResponse "JWT токен успешно создан"
-// @Failure 400 {object} ErrorResponse "Некорректный запрос"
+// @Param request body RegisterRequest true "Данные пользователя для регистрации"
+// @Success 200 {object} TokenResponse "Access и refresh токены успешно созданы"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос или ошибки валидации полей"
+// @Failure 409 {object} ErrorResponse "Пользователь с таким именем уже существует"
 // @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
 // @Router /register [post]
 func (c *AuthController) Register() http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		var data User
+		var data RegisterRequest
 		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
 			responder.ErrorBadRequest(w, err)
 			return
 		}
 
-		_, tokenString, err := c.tokenAuth.Encode(map[string]interface{}{"email": data.Username})
+		data.Username = strings.TrimSpace(data.Username)
+		data.Email = strings.TrimSpace(data.Email)
+		if data.Email == "" && strings.Contains(data.Username, "@") {
+			data.Email = data.Username
+		}
+
+		if errs := c.validateRegistration(&data); len(errs) > 0 {
+			responder.ErrorValidation(w, errs, errs)
+			return
+		}
+
+		passwordHash, err := c.hasher.Hash(data.Password)
 		if err != nil {
 			responder.ErrorInternal(w, err)
 			return
 		}
 
-		hashedBytes, err := bcrypt.GenerateFromPassword([]byte(data.Password), bcrypt.DefaultCost)
+		user := &User{Username: data.Username, Email: data.Email, PasswordHash: passwordHash}
+		if err := c.users.Create(r.Context(), user); err != nil {
+			if errors.Is(err, ErrUserExists) {
+				responder.ErrorConflict(w, err)
+				return
+			}
+			responder.ErrorInternal(w, err)
+			return
+		}
+		if err := c.roles.AssignDefaults(r.Context(), user); err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		recordAudit(r.Context(), c.audit, userEvent(audit.EventUserRegister, user, nil))
+		if c.verification != nil {
+			c.verification.SendAsync(user)
+		}
+
+		tokens, err := c.tokens.Issue(r.Context(), user)
 		if err != nil {
 			responder.ErrorInternal(w, err)
 			return
 		}
 
-		c.user.Password = string(hashedBytes)
-		c.user.Username = data.Username
-		responder.OutputJSON(w, TokenResponse{Token: tokenString})
+		outputTokens(w, c.sessions, tokens)
 	}
 }
 
+func (c *AuthController) validateRegistration(data *RegisterRequest) ValidationErrors {
+	errs := ValidationErrors{}
+	if reason := ValidateUsername(data.Username); reason != "" {
+		errs["username"] = reason
+	}
+	if data.Email != "" {
+		if reason := ValidateEmail(data.Email); reason != "" {
+			errs["email"] = reason
+		}
+	} else if c.verification != nil {
+		errs["email"] = "is required"
+	}
+	if data.Password == "" {
+		errs["password"] = "is required"
+	} else if reason := c.policy.Validate(data.Password, data.Username); reason != "" {
+		errs["password"] = reason
+	}
+	return errs
+}
+
 // Login godoc
 // @Summary Вход пользователя
-// @Description Аутентифицирует пользователя и возвращает JWT токен
+// @Description Аутентифицирует пользователя и возвращает JWT токен. Если у пользователя включена двухфакторная аутентификация, вместо токенов возвращается MFAChallengeResponse, и вход завершается через /login/mfa. После серии неудачных попыток вход для имени пользователя или IP адреса блокируется на растущий интервал. Если включены сессии, токены также сохраняются в HttpOnly cookie, а в cookie csrf_token выдается CSRF токен
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param request body User true "Учетные данные пользователя"
-// @Success 200 {object} TokenResponse "JWT токен успешно создан"
+// @Param request body Credentials true "Учетные данные пользователя"
+// @Success 200 {object} TokenResponse "Access и refresh токены успешно созданы"
 // @Failure 400 {object} ErrorResponse "Некорректный запрос"
 // @Failure 401 {object} ErrorResponse "Неверное имя пользователя или пароль"
+// @Failure 403 {object} ErrorResponse "Учетная запись отключена администратором"
+// @Failure 429 {object} ErrorResponse "Слишком много неудачных попыток входа, время ожидания в заголовке Retry-After"
 // @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
 // @Router /login [post]
 func (c *AuthController) Login() http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		var data User
+		var data Credentials
 		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
 			responder.ErrorBadRequest(w, err)
 			return
 		}
 
-		_, tokenString, err := c.tokenAuth.Encode(TokenClaims{"username": data.Username})
+		ip := clientIP(r)
+		if wait := c.guard.Check(data.Username, ip); wait > 0 {
+			responder.ErrorTooManyRequests(w, ErrLoginLocked, wait)
+			return
+		}
+
+		user, err := c.users.GetByUsername(r.Context(), data.Username)
+		if errors.Is(err, ErrUserNotFound) {
+			// Hash the password anyway, so unknown usernames take as long
+			// as wrong passwords.
+			c.hasher.VerifyDummy(data.Password)
+			c.loginFailed(w, r, nil, data.Username, ip)
+			return
+		}
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		needsRehash, err := c.hasher.Verify(user.PasswordHash, data.Password)
+		if errors.Is(err, ErrPasswordMismatch) {
+			c.loginFailed(w, r, user, data.Username, ip)
+			return
+		}
 		if err != nil {
 			responder.ErrorInternal(w, err)
 			return
 		}
+		if needsRehash {
+			c.upgradeHash(r.Context(), user, data.Password)
+		}
+		// Checked only after the password, so the response does not reveal
+		// which accounts exist.
+		if user.DisabledAt != nil {
+			c.recordLoginFailure(r.Context(), user, user.Username, "account_disabled")
+			responder.ErrorForbidden(w, ErrUserDisabled)
+			return
+		}
 
-		if data.Username != c.user.Username {
-			responder.ErrorUnauthorized(w, errors.New("invalid username or password"))
+		mfaEnabled, err := c.mfa.Enabled(r.Context(), user.ID)
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		if mfaEnabled {
+			// The failure counter is only reset after the second step, so
+			// knowing the password does not give unlimited code guesses.
+			challenge, err := c.mfa.Challenge(user)
+			if err != nil {
+				responder.ErrorInternal(w, err)
+				return
+			}
+			responder.OutputJSON(w, MFAChallengeResponse{
+				MFARequired: true,
+				MFAToken:    challenge,
+				ExpiresIn:   int64(c.mfa.ChallengeTTL().Seconds()),
+			})
+			return
+		}
+		c.guard.Success(data.Username)
+
+		tokens, err := c.tokens.Issue(r.Context(), user)
+		if err != nil {
+			responder.ErrorInternal(w, err)
 			return
 		}
+		c.recordLoginSuccess(r.Context(), user, "password")
 
-		if err := bcrypt.CompareHashAndPassword([]byte(c.user.Password), []byte(data.Password)); err != nil {
-			responder.ErrorUnauthorized(w, errors.New("invalid username or password"))
+		outputTokens(w, c.sessions, tokens)
+	}
+}
+
+// LoginMFA godoc
+// @Summary Второй шаг входа
+// @Description Обменивает mfa_token, полученный от /login, и код из приложения-аутентификатора или код восстановления на пару токенов. Неверные коды учитываются в блокировке входа
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body LoginMFARequest true "Токен первого шага и код"
+// @Success 200 {object} TokenResponse "Access и refresh токены успешно созданы"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос"
+// @Failure 401 {object} ErrorResponse "mfa_token недействителен или истек, либо код неверен"
+// @Failure 403 {object} ErrorResponse "Учетная запись отключена администратором"
+// @Failure 429 {object} ErrorResponse "Слишком много неудачных попыток входа, время ожидания в заголовке Retry-After"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /login/mfa [post]
+func (c *AuthController) LoginMFA() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data LoginMFARequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+		if data.MFAToken == "" || data.Code == "" {
+			responder.ErrorBadRequest(w, errors.New("mfa_token and code are required"))
 			return
 		}
 
-		responder.OutputJSON(w, TokenResponse{Token: tokenString})
+		userID, err := c.mfa.ParseChallenge(data.MFAToken)
+		if err != nil {
+			responder.ErrorUnauthorized(w, err)
+			return
+		}
+		user, err := c.users.GetByID(r.Context(), userID)
+		if errors.Is(err, ErrUserNotFound) {
+			responder.ErrorUnauthorized(w, ErrMFAChallengeInvalid)
+			return
+		}
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		if user.DisabledAt != nil {
+			c.recordLoginFailure(r.Context(), user, user.Username, "account_disabled")
+			responder.ErrorForbidden(w, ErrUserDisabled)
+			return
+		}
+
+		ip := clientIP(r)
+		if wait := c.guard.Check(user.Username, ip); wait > 0 {
+			responder.ErrorTooManyRequests(w, ErrLoginLocked, wait)
+			return
+		}
+		err = c.mfa.Verify(r.Context(), user.ID, data.Code)
+		if errors.Is(err, ErrMFACodeInvalid) {
+			c.recordLoginFailure(r.Context(), user, user.Username, "mfa_code_invalid")
+			if wait := c.guard.Failure(r.Context(), user.Username, ip); wait > 0 {
+				responder.ErrorTooManyRequests(w, ErrLoginLocked, wait)
+				return
+			}
+			responder.ErrorUnauthorized(w, err)
+			return
+		}
+		if errors.Is(err, ErrMFANotEnrolled) {
+			// Two-factor authentication was disabled in the meantime.
+			responder.ErrorUnauthorized(w, ErrMFAChallengeInvalid)
+			return
+		}
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		c.guard.Success(user.Username)
+
+		tokens, err := c.tokens.Issue(r.Context(), user)
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		c.recordLoginSuccess(r.Context(), user, "mfa")
+
+		outputTokens(w, c.sessions, tokens)
+	}
+}
+
+// outputTokens responds with the token pair and, when sessions are enabled,
+// stores it in the session cookies as well.
+func outputTokens(w http.ResponseWriter, sessions *Sessions, tokens *TokenResponse) {
+	if sessions != nil {
+		if err := sessions.Start(w, tokens); err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+	}
+	responder.OutputJSON(w, tokens)
+}
+
+// upgradeHash replaces a hash made with another algorithm or outdated
+// parameters. A failure does not fail the login, the hash is upgraded on one
+// of the next logins instead.
+func (c *AuthController) upgradeHash(ctx context.Context, user *User, password string) {
+	passwordHash, err := c.hasher.Hash(password)
+	if err == nil {
+		user.PasswordHash = passwordHash
+		err = c.users.Update(ctx, user)
+	}
+	if err != nil {
+		log.Printf("upgrade password hash of user %d: %v", user.ID, err)
+	}
+}
+
+// loginFailed responds the same way whether the user is unknown or the
+// password is wrong. user is nil for unknown usernames.
+func (c *AuthController) loginFailed(w http.ResponseWriter, r *http.Request, user *User, username, ip string) {
+	c.recordLoginFailure(r.Context(), user, username, "invalid_credentials")
+	if wait := c.guard.Failure(r.Context(), username, ip); wait > 0 {
+		responder.ErrorTooManyRequests(w, ErrLoginLocked, wait)
+		return
+	}
+	responder.ErrorUnauthorized(w, errors.New("invalid username or password"))
+}
+
+func (c *AuthController) recordLoginSuccess(ctx context.Context, user *User, method string) {
+	recordAudit(ctx, c.audit, userEvent(audit.EventLoginSuccess, user, map[string]string{"method": method}))
+}
+
+// recordLoginFailure records a failed login. user is nil if the username is
+// unknown.
+func (c *AuthController) recordLoginFailure(ctx context.Context, user *User, username, reason string) {
+	details := map[string]string{"reason": reason}
+	if user == nil {
+		recordAudit(ctx, c.audit, audit.Event{Type: audit.EventLoginFailure, Username: username, Details: details})
+		return
+	}
+	recordAudit(ctx, c.audit, userEvent(audit.EventLoginFailure, user, details))
+}
+
+// Refresh godoc
+// @Summary Обновление токенов
+// @Description Обменивает refresh токен на новую пару access и refresh токенов. Каждый refresh токен одноразовый: повторное предъявление уже использованного токена отзывает всю цепочку токенов этой сессии. Если включены сессии и тело пустое, используется refresh токен из cookie, при этом нужен заголовок X-CSRF-Token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body RefreshRequest false "Refresh токен"
+// @Success 200 {object} TokenResponse "Новая пара токенов"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос"
+// @Failure 401 {object} ErrorResponse "Refresh токен недействителен, истек или уже использован"
+// @Failure 403 {object} ErrorResponse "Учетная запись отключена администратором"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /token/refresh [post]
+func (c *AuthController) Refresh() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil && !errors.Is(err, io.EOF) {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+		if data.RefreshToken == "" && c.sessions != nil {
+			data.RefreshToken = c.sessions.RefreshTokenFromCookie(r)
+		}
+		if data.RefreshToken == "" {
+			responder.ErrorBadRequest(w, errors.New("refresh_token is required"))
+			return
+		}
+
+		tokens, err := c.tokens.Refresh(r.Context(), data.RefreshToken)
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+			responder.ErrorUnauthorized(w, err)
+			return
+		}
+		if errors.Is(err, ErrUserDisabled) {
+			responder.ErrorForbidden(w, err)
+			return
+		}
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		outputTokens(w, c.sessions, tokens)
+	}
+}
+
+// Logout godoc
+// @Summary Выход из системы
+// @Description Отзывает текущий access токен. Если передан refresh токен, отзывается и вся цепочка refresh токенов этой сессии. Cookie сессии удаляются
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body LogoutRequest false "Refresh токен текущей сессии"
+// @Success 204 "Токены отозваны"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /logout [post]
+func (c *AuthController) Logout() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data LogoutRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil && !errors.Is(err, io.EOF) {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+
+		if data.RefreshToken == "" && c.sessions != nil {
+			data.RefreshToken = c.sessions.RefreshTokenFromCookie(r)
+		}
+
+		claims, _ := ClaimsFromContext(r.Context())
+		if err := c.tokens.Logout(r.Context(), claims.UserID(), claims.TokenID, claims.ExpiresAt, data.RefreshToken); err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		if c.sessions != nil {
+			c.sessions.End(w)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Me godoc
+// @Summary Текущий пользователь
+// @Description Возвращает профиль аутентифицированного пользователя и метаданные токена, с которым выполнен запрос
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} MeResponse "Профиль и метаданные токена"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /me [get]
+func (c *AuthController) Me() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := ClaimsFromContext(r.Context())
+		user, ok := currentUser(w, r, c.users)
+		if !ok {
+			return
+		}
+
+		responder.OutputJSON(w, MeResponse{
+			User: NewUserProfile(user),
+			Token: TokenInfo{
+				ID:              claims.TokenID,
+				Issuer:          claims.Issuer,
+				Audience:        claims.Audience,
+				IssuedAt:        claims.IssuedAt,
+				ExpiresAt:       claims.ExpiresAt,
+				Roles:           claims.Roles,
+				Permissions:     claims.Permissions,
+				PersonalTokenID: claims.PersonalTokenID,
+			},
+		})
+	}
+}
+
+// ChangePassword godoc
+// @Summary Смена пароля
+// @Description Меняет пароль текущего пользователя. Требует текущий пароль. Все остальные сессии завершаются, API ключи и персональные токены отзываются, для текущей сессии возвращается новая пара токенов
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ChangePasswordRequest true "Текущий и новый пароль"
+// @Success 200 {object} TokenResponse "Пароль изменен, новая пара токенов"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос, неверный текущий пароль или новый пароль не соответствует требованиям"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 429 {object} ErrorResponse "Слишком много неудачных попыток, время ожидания в заголовке Retry-After"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /me/password [put]
+func (c *AuthController) ChangePassword() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data ChangePasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+
+		user, ok := currentUser(w, r, c.users)
+		if !ok {
+			return
+		}
+
+		// The current password can be guessed here as well, so failures
+		// count towards the login lockout.
+		ip := clientIP(r)
+		if wait := c.guard.Check(user.Username, ip); wait > 0 {
+			responder.ErrorTooManyRequests(w, ErrLoginLocked, wait)
+			return
+		}
+		_, err := c.hasher.Verify(user.PasswordHash, data.CurrentPassword)
+		if errors.Is(err, ErrPasswordMismatch) {
+			if wait := c.guard.Failure(r.Context(), user.Username, ip); wait > 0 {
+				responder.ErrorTooManyRequests(w, ErrLoginLocked, wait)
+				return
+			}
+			errs := ValidationErrors{"current_password": "is incorrect"}
+			responder.ErrorValidation(w, errs, errs)
+			return
+		}
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		c.guard.Success(user.Username)
+
+		errs := ValidationErrors{}
+		if data.NewPassword == "" {
+			errs["new_password"] = "is required"
+		} else if data.NewPassword == data.CurrentPassword {
+			errs["new_password"] = "must differ from the current password"
+		} else if reason := c.policy.Validate(data.NewPassword, user.Username); reason != "" {
+			errs["new_password"] = reason
+		}
+		if len(errs) > 0 {
+			responder.ErrorValidation(w, errs, errs)
+			return
+		}
+
+		passwordHash, err := c.hasher.Hash(data.NewPassword)
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		user.PasswordHash = passwordHash
+		if err := c.users.Update(r.Context(), user); err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		recordAudit(r.Context(), c.audit, userEvent(audit.EventPasswordChange, user, nil))
+
+		tokens, err := c.tokens.RevokeAllAndIssue(r.Context(), user)
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		outputTokens(w, c.sessions, tokens)
+	}
+}
+
+// UpdateProfile godoc
+// @Summary Изменение профиля
+// @Description Изменяет переданные поля профиля текущего пользователя. После смены email адрес нужно подтвердить заново. Claims в уже выданных токенах обновятся при следующем обновлении токена
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpdateProfileRequest true "Изменяемые поля"
+// @Success 200 {object} UserProfile "Обновленный профиль"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос или ошибки валидации полей"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /me [patch]
+func (c *AuthController) UpdateProfile() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data UpdateProfileRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+
+		user, ok := currentUser(w, r, c.users)
+		if !ok {
+			return
+		}
+
+		errs := ValidationErrors{}
+		if data.DisplayName != nil {
+			name := strings.TrimSpace(*data.DisplayName)
+			if reason := ValidateDisplayName(name); reason != "" {
+				errs["display_name"] = reason
+			} else {
+				user.DisplayName = name
+			}
+		}
+		emailChanged := false
+		if data.Email != nil {
+			email := strings.TrimSpace(*data.Email)
+			if email == "" && c.verification != nil {
+				errs["email"] = "is required"
+			} else if email != "" {
+				if reason := ValidateEmail(email); reason != "" {
+					errs["email"] = reason
+				}
+			}
+			if _, invalid := errs["email"]; !invalid && email != user.Email {
+				user.Email = email
+				user.EmailVerifiedAt = nil
+				emailChanged = true
+			}
+		}
+		if len(errs) > 0 {
+			responder.ErrorValidation(w, errs, errs)
+			return
+		}
+
+		if err := c.users.Update(r.Context(), user); err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		if emailChanged && user.Email != "" && c.verification != nil {
+			c.verification.SendAsync(user)
+		}
+
+		responder.OutputJSON(w, NewUserProfile(user))
+	}
+}
+
+// currentUser loads the user of the request and responds with an error if
+// that fails.
+func currentUser(w http.ResponseWriter, r *http.Request, users UserRepository) (*User, bool) {
+	claims, _ := ClaimsFromContext(r.Context())
+	user, err := users.GetByID(r.Context(), claims.UserID())
+	if errors.Is(err, ErrUserNotFound) {
+		responder.ErrorUnauthorized(w, err)
+		return nil, false
+	}
+	if err != nil {
+		responder.ErrorInternal(w, err)
+		return nil, false
 	}
+	return user, true
 }
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newLoginTestController(t *testing.T) *AuthController {
+	t.Helper()
+	hasher, err := NewPasswordHasher(&BcryptHasher{Cost: bcrypt.DefaultCost})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := NewMemoryUserRepository()
+	passwordHash, err := hasher.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Create(context.Background(), &User{Username: "alice", PasswordHash: passwordHash}); err != nil {
+		t.Fatal(err)
+	}
+	// Accounts provisioned by OIDC have no password.
+	if err := users.Create(context.Background(), &User{Username: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	// Lockouts are disabled, so every attempt reaches the password check.
+	guard := NewLoginGuard(LockoutConfig{ResetAfter: time.Hour}, nil)
+	return NewAuthController(nil, users, nil, nil, hasher, guard, nil, nil, nil, nil)
+}
+
+func login(t *testing.T, c *AuthController, username, password string) (*httptest.ResponseRecorder, time.Duration) {
+	t.Helper()
+	body, _ := json.Marshal(Credentials{Username: username, Password: password})
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+	req.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	c.Login()(rec, req)
+	return rec, time.Since(start)
+}
+
+func TestLoginUnknownUserLooksLikeWrongPassword(t *testing.T) {
+	c := newLoginTestController(t)
+
+	wrong, _ := login(t, c, "alice", "wrong password")
+	if wrong.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status %d, want %d", wrong.Code, http.StatusUnauthorized)
+	}
+	for _, username := range []string{"mallory", "bob"} {
+		rec, _ := login(t, c, username, "wrong password")
+		if rec.Code != wrong.Code {
+			t.Errorf("%s: status %d, want %d", username, rec.Code, wrong.Code)
+		}
+		if rec.Body.String() != wrong.Body.String() {
+			t.Errorf("%s: body %q, want %q", username, rec.Body.String(), wrong.Body.String())
+		}
+		if rec.Header().Get("Content-Type") != wrong.Header().Get("Content-Type") {
+			t.Errorf("%s: content type %q, want %q", username, rec.Header().Get("Content-Type"), wrong.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestLoginUnknownUserTakesAsLongAsWrongPassword(t *testing.T) {
+	if testing.Short() {
+		t.Skip("hashes passwords")
+	}
+	c := newLoginTestController(t)
+
+	const attempts = 5
+	average := func(username string) time.Duration {
+		var total time.Duration
+		for i := 0; i < attempts; i++ {
+			_, elapsed := login(t, c, username, "wrong password")
+			total += elapsed
+		}
+		return total / attempts
+	}
+	wrong := average("alice")
+	for _, username := range []string{"mallory", "bob"} {
+		elapsed := average(username)
+		// Both cases hash the password once with the same cost, so they may
+		// only differ by scheduling noise, not by a factor.
+		if elapsed < wrong/2 || elapsed > wrong*2 {
+			t.Errorf("%s: login took %v on average, wrong password took %v", username, elapsed, wrong)
+		}
+	}
+}
+
+func TestNewPasswordHasherFailsOnBrokenAlgorithm(t *testing.T) {
+	if _, err := NewPasswordHasher(&BcryptHasher{Cost: bcrypt.MaxCost + 1}); err == nil {
+		t.Fatal("expected an error for an invalid bcrypt cost")
+	}
+}
@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lastUsedPrecision limits how often the last use of a credential is written.
+const lastUsedPrecision = time.Minute
+
+const (
+	// credentialPrefixBytes is the length of the random lookup prefix.
+	credentialPrefixBytes = 8
+	// credentialCreateAttempts bounds the retries on a prefix collision.
+	credentialCreateAttempts = 3
+)
+
+var (
+	ErrCredentialNotFound    = errors.New("credential not found")
+	ErrCredentialPrefixTaken = errors.New("credential prefix is already taken")
+)
+
+// Credential is a long-lived secret a user creates for machine clients or
+// scripts: an API key or a personal access token. The raw credential is
+// "<kind prefix>_<Prefix>_<secret>". Only its SHA-256 hash is stored; the
+// public Prefix is used to look it up and to show its owner which credential
+// is which.
+type Credential struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	Prefix     string
+	SecretHash string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time // nil for credentials that do not expire
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+type CredentialRepository interface {
+	// Create returns ErrCredentialPrefixTaken if another credential has the
+	// same prefix.
+	Create(ctx context.Context, credential *Credential) error
+	// GetByPrefix returns ErrCredentialNotFound for an unknown prefix.
+	GetByPrefix(ctx context.Context, prefix string) (*Credential, error)
+	ListByUser(ctx context.Context, userID int64) ([]Credential, error)
+	// Revoke revokes the credential only if it belongs to userID.
+	Revoke(ctx context.Context, userID, id int64, at time.Time) error
+	// RevokeUser revokes every credential of the user.
+	RevokeUser(ctx context.Context, userID int64, at time.Time) error
+	TouchLastUsed(ctx context.Context, id int64, at time.Time) error
+}
+
+type MemoryCredentialRepository struct {
+	mu          sync.Mutex
+	lastID      int64
+	credentials map[int64]*Credential
+	byPrefix    map[string]int64
+}
+
+func NewMemoryCredentialRepository() *MemoryCredentialRepository {
+	return &MemoryCredentialRepository{
+		credentials: make(map[int64]*Credential),
+		byPrefix:    make(map[string]int64),
+	}
+}
+
+func (r *MemoryCredentialRepository) Create(ctx context.Context, credential *Credential) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.byPrefix[credential.Prefix]; ok {
+		return ErrCredentialPrefixTaken
+	}
+	r.lastID++
+	credential.ID = r.lastID
+	credential.CreatedAt = time.Now().UTC()
+
+	stored := *credential
+	stored.Scopes = append([]string(nil), credential.Scopes...)
+	r.credentials[credential.ID] = &stored
+	r.byPrefix[credential.Prefix] = credential.ID
+	return nil
+}
+
+func (r *MemoryCredentialRepository) GetByPrefix(ctx context.Context, prefix string) (*Credential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.byPrefix[prefix]
+	if !ok {
+		return nil, ErrCredentialNotFound
+	}
+	found := *r.credentials[id]
+	return &found, nil
+}
+
+func (r *MemoryCredentialRepository) ListByUser(ctx context.Context, userID int64) ([]Credential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := []Credential{}
+	for _, credential := range r.credentials {
+		if credential.UserID == userID {
+			res = append(res, *credential)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+func (r *MemoryCredentialRepository) Revoke(ctx context.Context, userID, id int64, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	credential, ok := r.credentials[id]
+	if !ok || credential.UserID != userID {
+		return ErrCredentialNotFound
+	}
+	if credential.RevokedAt == nil {
+		credential.RevokedAt = &at
+	}
+	return nil
+}
+
+func (r *MemoryCredentialRepository) RevokeUser(ctx context.Context, userID int64, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, credential := range r.credentials {
+		if credential.UserID == userID && credential.RevokedAt == nil {
+			credential.RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+func (r *MemoryCredentialRepository) TouchLastUsed(ctx context.Context, id int64, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if credential, ok := r.credentials[id]; ok {
+		credential.LastUsedAt = &at
+	}
+	return nil
+}
+
+// credentialKind is what tells the kinds of credentials apart.
+type credentialKind struct {
+	// prefix starts every raw credential of the kind, e.g. "hp".
+	prefix string
+	// name is used in log messages.
+	name     string
+	notFound error
+	invalid  error
+}
+
+// matches reports whether raw looks like a credential of this kind.
+func (k credentialKind) matches(raw string) bool {
+	return strings.HasPrefix(raw, k.prefix+"_")
+}
+
+// credentialStore creates credentials of one kind and resolves raw
+// credentials to the claims of their owners.
+type credentialStore struct {
+	kind  credentialKind
+	repo  CredentialRepository
+	users UserRepository
+	roles *RoleService
+}
+
+// create issues a credential and returns it together with the raw
+// credential, which is not stored and can not be shown again. A prefix
+// collision is retried with a new prefix.
+func (s *credentialStore) create(ctx context.Context, userID int64, name string, scopes []string, expiresAt *time.Time) (*Credential, string, error) {
+	var err error
+	for attempt := 0; attempt < credentialCreateAttempts; attempt++ {
+		var credential *Credential
+		var raw string
+		credential, raw, err = s.tryCreate(ctx, userID, name, scopes, expiresAt)
+		if !errors.Is(err, ErrCredentialPrefixTaken) {
+			return credential, raw, err
+		}
+	}
+	return nil, "", err
+}
+
+func (s *credentialStore) tryCreate(ctx context.Context, userID int64, name string, scopes []string, expiresAt *time.Time) (*Credential, string, error) {
+	b := make([]byte, credentialPrefixBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	prefix := hex.EncodeToString(b)
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	raw := s.kind.prefix + "_" + prefix + "_" + secret
+
+	credential := &Credential{
+		UserID:     userID,
+		Name:       name,
+		Prefix:     prefix,
+		SecretHash: hashToken(raw),
+		Scopes:     scopes,
+		ExpiresAt:  expiresAt,
+	}
+	if err := s.repo.Create(ctx, credential); err != nil {
+		return nil, "", err
+	}
+	return credential, raw, nil
+}
+
+func (s *credentialStore) List(ctx context.Context, userID int64) ([]Credential, error) {
+	return s.repo.ListByUser(ctx, userID)
+}
+
+func (s *credentialStore) Revoke(ctx context.Context, userID, id int64) error {
+	err := s.repo.Revoke(ctx, userID, id, time.Now().UTC())
+	if errors.Is(err, ErrCredentialNotFound) {
+		return s.kind.notFound
+	}
+	return err
+}
+
+// authenticate resolves a raw credential to the claims of its owner. The
+// credential only grants those of its scopes that the owner's roles still
+// allow. The caller sets the ID of the credential in the claims.
+func (s *credentialStore) authenticate(ctx context.Context, raw string) (*Credential, *Claims, error) {
+	parts := strings.SplitN(raw, "_", 3)
+	if len(parts) != 3 || parts[0] != s.kind.prefix {
+		return nil, nil, s.kind.invalid
+	}
+
+	credential, err := s.repo.GetByPrefix(ctx, parts[1])
+	if errors.Is(err, ErrCredentialNotFound) {
+		return nil, nil, s.kind.invalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now().UTC()
+	if subtle.ConstantTimeCompare([]byte(hashToken(raw)), []byte(credential.SecretHash)) != 1 ||
+		credential.RevokedAt != nil || (credential.ExpiresAt != nil && !now.Before(*credential.ExpiresAt)) {
+		return nil, nil, s.kind.invalid
+	}
+
+	user, err := s.users.GetByID(ctx, credential.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, nil, s.kind.invalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	_, permissions, err := s.roles.Resolve(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if credential.LastUsedAt == nil || now.Sub(*credential.LastUsedAt) >= lastUsedPrecision {
+		if err := s.repo.TouchLastUsed(ctx, credential.ID, now); err != nil {
+			log.Printf("update last use of %s %d: %v", s.kind.name, credential.ID, err)
+		}
+	}
+
+	return credential, &Claims{
+		Subject:     strconv.FormatInt(user.ID, 10),
+		Username:    user.Username,
+		Email:       user.Email,
+		TenantID:    user.TenantID,
+		Roles:       []string{},
+		Permissions: intersect(credential.Scopes, permissions),
+	}, nil
+}
+
+func intersect(a, b []string) []string {
+	set := make(map[string]struct{}, len(b))
+	for _, item := range b {
+		set[item] = struct{}{}
+	}
+	res := []string{}
+	for _, item := range a {
+		if _, ok := set[item]; ok {
+			res = append(res, item)
+		}
+	}
+	return res
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+const credentialColumns = `id, user_id, name, prefix, secret_hash, scopes, created_at, expires_at, last_used_at, revoked_at`
+
+// SQLiteCredentialRepository stores the credentials of one kind in its own
+// table. All credential tables have the same columns.
+type SQLiteCredentialRepository struct {
+	db    *sql.DB
+	table string
+}
+
+func (r *SQLiteCredentialRepository) Create(ctx context.Context, credential *Credential) error {
+	credential.CreatedAt = time.Now().UTC()
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO `+r.table+` (user_id, name, prefix, secret_hash, scopes, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		credential.UserID, credential.Name, credential.Prefix, credential.SecretHash,
+		strings.Join(credential.Scopes, " "), credential.CreatedAt, credential.ExpiresAt,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrCredentialPrefixTaken
+		}
+		return err
+	}
+	credential.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *SQLiteCredentialRepository) GetByPrefix(ctx context.Context, prefix string) (*Credential, error) {
+	credential, err := scanCredential(r.db.QueryRowContext(ctx,
+		`SELECT `+credentialColumns+` FROM `+r.table+` WHERE prefix = ?`, prefix,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCredentialNotFound
+	}
+	return credential, err
+}
+
+func (r *SQLiteCredentialRepository) ListByUser(ctx context.Context, userID int64) ([]Credential, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+credentialColumns+` FROM `+r.table+` WHERE user_id = ? ORDER BY id`, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []Credential{}
+	for rows.Next() {
+		credential, err := scanCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *credential)
+	}
+	return res, rows.Err()
+}
+
+func (r *SQLiteCredentialRepository) Revoke(ctx context.Context, userID, id int64, at time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE `+r.table+` SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ? AND user_id = ?`, at.UTC(), id, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteCredentialRepository) RevokeUser(ctx context.Context, userID int64, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE `+r.table+` SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, at.UTC(), userID,
+	)
+	return err
+}
+
+func (r *SQLiteCredentialRepository) TouchLastUsed(ctx context.Context, id int64, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE `+r.table+` SET last_used_at = ? WHERE id = ?`, at.UTC(), id)
+	return err
+}
+
+func scanCredential(row rowScanner) (*Credential, error) {
+	var credential Credential
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&credential.ID, &credential.UserID, &credential.Name, &credential.Prefix, &credential.SecretHash, &scopes,
+		&credential.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	credential.Scopes = strings.Fields(scopes)
+	if expiresAt.Valid {
+		credential.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		credential.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		credential.RevokedAt = &revokedAt.Time
+	}
+	return &credential, nil
+}
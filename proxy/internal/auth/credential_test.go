@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"test/internal/database"
+)
+
+type credentialRepositories struct {
+	apiKeys, personalTokens CredentialRepository
+	users                   UserRepository
+}
+
+func memoryCredentialRepositories(t *testing.T) credentialRepositories {
+	return credentialRepositories{
+		apiKeys:        NewMemoryCredentialRepository(),
+		personalTokens: NewMemoryCredentialRepository(),
+		users:          NewMemoryUserRepository(),
+	}
+}
+
+func sqliteCredentialRepositories(t *testing.T) credentialRepositories {
+	db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	users, err := NewSQLiteUserRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKeys, err := NewSQLiteAPIKeyRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	personalTokens, err := NewSQLitePersonalTokenRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return credentialRepositories{apiKeys: apiKeys, personalTokens: personalTokens, users: users}
+}
+
+func TestCredentials(t *testing.T) {
+	for name, open := range map[string]func(t *testing.T) credentialRepositories{
+		"memory": memoryCredentialRepositories,
+		"sqlite": sqliteCredentialRepositories,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repos := open(t)
+			user := &User{Username: "alice"}
+			if err := repos.users.Create(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+			roles := NewRoleService(NewMemoryRoleRepository(), repos.users, nil)
+			if err := roles.Seed(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := roles.AssignDefaults(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+			apiKeys := NewAPIKeyService(repos.apiKeys, repos.users, roles)
+			personalTokens := NewPersonalTokenService(repos.personalTokens, repos.users, roles)
+
+			key, rawKey, err := apiKeys.Create(ctx, user.ID, "import", []string{PermissionAddressSearch, PermissionTokensRevoke})
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := apiKeys.Authenticate(ctx, rawKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.APIKeyID != key.ID || claims.UserID() != user.ID {
+				t.Errorf("api key claims %+v", claims)
+			}
+			// Scopes the roles of the owner do not grant are dropped.
+			if len(claims.Permissions) != 1 || claims.Permissions[0] != PermissionAddressSearch {
+				t.Errorf("api key grants %v", claims.Permissions)
+			}
+
+			expiresAt := time.Now().UTC().Add(time.Hour)
+			token, rawToken, err := personalTokens.Create(ctx, user.ID, "script", []string{PermissionAddressSearch}, &expiresAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err = personalTokens.Authenticate(ctx, rawToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.PersonalTokenID != token.ID || claims.ExpiresAt.IsZero() {
+				t.Errorf("personal token claims %+v", claims)
+			}
+
+			// A credential of one kind is not accepted as the other.
+			if _, err := personalTokens.Authenticate(ctx, rawKey); !errors.Is(err, ErrInvalidPersonalToken) {
+				t.Errorf("api key as personal token: got %v", err)
+			}
+			if _, err := apiKeys.Authenticate(ctx, rawToken); !errors.Is(err, ErrInvalidAPIKey) {
+				t.Errorf("personal token as api key: got %v", err)
+			}
+			if _, err := apiKeys.Authenticate(ctx, rawKey+"x"); !errors.Is(err, ErrInvalidAPIKey) {
+				t.Errorf("wrong secret: got %v", err)
+			}
+
+			keys, err := apiKeys.List(ctx, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys) != 1 || keys[0].LastUsedAt == nil {
+				t.Errorf("listed keys %+v, want one with its last use", keys)
+			}
+
+			if err := apiKeys.Revoke(ctx, user.ID+1, key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+				t.Errorf("revoke key of another user: got %v", err)
+			}
+			if err := apiKeys.Revoke(ctx, user.ID, key.ID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := apiKeys.Authenticate(ctx, rawKey); !errors.Is(err, ErrInvalidAPIKey) {
+				t.Errorf("revoked key: got %v", err)
+			}
+
+			expired := time.Now().UTC().Add(-time.Minute)
+			_, rawExpired, err := personalTokens.Create(ctx, user.ID, "old", []string{PermissionAddressSearch}, &expired)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := personalTokens.Authenticate(ctx, rawExpired); !errors.Is(err, ErrInvalidPersonalToken) {
+				t.Errorf("expired token: got %v", err)
+			}
+		})
+	}
+}
+
+func TestRevokeEverythingRevokesCredentials(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	user := &User{Username: "alice"}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	roles := NewRoleService(NewMemoryRoleRepository(), users, nil)
+	if err := roles.Seed(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := roles.AssignDefaults(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	keyRepo, tokenRepo := NewMemoryCredentialRepository(), NewMemoryCredentialRepository()
+	apiKeys := NewAPIKeyService(keyRepo, users, roles)
+	personalTokens := NewPersonalTokenService(tokenRepo, users, roles)
+	tokens := NewTokenService(nil, NewMemoryRefreshTokenRepository(), users, roles, NewDenylist(nil, time.Minute),
+		[]CredentialRepository{keyRepo, tokenRepo}, nil, TokenConfig{})
+
+	_, rawKey, err := apiKeys.Create(ctx, user.ID, "import", []string{PermissionAddressSearch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rawToken, err := personalTokens.Create(ctx, user.ID, "script", []string{PermissionAddressSearch}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Role changes only revoke sessions; credentials follow the new roles.
+	if err := roles.SetRoles(ctx, user.ID, []string{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tokens.RevokeAllForUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := apiKeys.Authenticate(ctx, rawKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claims.Permissions) != 0 {
+		t.Errorf("api key of a user without roles grants %v", claims.Permissions)
+	}
+
+	if err := tokens.RevokeEverything(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apiKeys.Authenticate(ctx, rawKey); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("api key after RevokeEverything: got %v", err)
+	}
+	if _, err := personalTokens.Authenticate(ctx, rawToken); !errors.Is(err, ErrInvalidPersonalToken) {
+		t.Errorf("personal token after RevokeEverything: got %v", err)
+	}
+}
+
+// collidingRepository reports a taken prefix for the first create calls.
+type collidingRepository struct {
+	CredentialRepository
+	collisions int
+}
+
+func (r *collidingRepository) Create(ctx context.Context, credential *Credential) error {
+	if r.collisions > 0 {
+		r.collisions--
+		return ErrCredentialPrefixTaken
+	}
+	return r.CredentialRepository.Create(ctx, credential)
+}
+
+func TestCredentialPrefixCollisions(t *testing.T) {
+	for name, open := range map[string]func(t *testing.T) credentialRepositories{
+		"memory": memoryCredentialRepositories,
+		"sqlite": sqliteCredentialRepositories,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repos := open(t)
+			user := &User{Username: "alice"}
+			if err := repos.users.Create(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+			roles := NewRoleService(NewMemoryRoleRepository(), repos.users, nil)
+			if err := roles.Seed(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := roles.AssignDefaults(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+
+			apiKeys := NewAPIKeyService(repos.apiKeys, repos.users, roles)
+			key, rawKey, err := apiKeys.Create(ctx, user.ID, "import", []string{PermissionAddressSearch})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(key.Prefix) != 2*credentialPrefixBytes {
+				t.Errorf("prefix %q", key.Prefix)
+			}
+
+			// A duplicate prefix is refused and the existing key keeps working.
+			duplicate := &Credential{UserID: user.ID, Name: "copy", Prefix: key.Prefix, SecretHash: "x"}
+			if err := repos.apiKeys.Create(ctx, duplicate); !errors.Is(err, ErrCredentialPrefixTaken) {
+				t.Errorf("duplicate prefix: got %v", err)
+			}
+			if _, err := apiKeys.Authenticate(ctx, rawKey); err != nil {
+				t.Errorf("key after a duplicate prefix: %v", err)
+			}
+
+			// Collisions are retried with a new prefix.
+			colliding := &collidingRepository{CredentialRepository: repos.apiKeys, collisions: credentialCreateAttempts - 1}
+			_, rawRetried, err := NewAPIKeyService(colliding, repos.users, roles).Create(ctx, user.ID, "retried", []string{PermissionAddressSearch})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := apiKeys.Authenticate(ctx, rawRetried); err != nil {
+				t.Errorf("retried key: %v", err)
+			}
+			colliding.collisions = credentialCreateAttempts
+			if _, _, err := NewAPIKeyService(colliding, repos.users, roles).Create(ctx, user.ID, "unlucky", nil); !errors.Is(err, ErrCredentialPrefixTaken) {
+				t.Errorf("persistent collisions: got %v", err)
+			}
+		})
+	}
+}
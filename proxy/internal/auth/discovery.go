@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"test/internal/responder"
+)
+
+type OpenIDConfiguration struct {
+	Issuer                           string   `json:"issuer"`
+	JwksURI                          string   `json:"jwks_uri"`
+	UserinfoEndpoint                 string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint            string   `json:"introspection_endpoint"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+}
+
+// DiscoveryController publishes the public verification keys and an
+// OpenID Connect style discovery document, so that other services can verify
+// tokens without sharing a secret with this one.
+type DiscoveryController struct {
+	keys    *KeyRing
+	issuer  string
+	baseURL string
+}
+
+func NewDiscoveryController(keys *KeyRing, issuer, baseURL string) *DiscoveryController {
+	return &DiscoveryController{
+		keys:    keys,
+		issuer:  issuer,
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// JWKS godoc
+// @Summary Публичные ключи для проверки токенов
+// @Description Возвращает JWK Set с публичными ключами, которыми можно проверить подпись выданных токенов. Набор включает ключи, ожидающие ротации, и ключи, которыми ещё могут быть подписаны действующие токены. При HS256 набор пуст
+// @Tags discovery
+// @Produce json
+// @Success 200 {object} object "JWK Set"
+// @Router /.well-known/jwks.json [get]
+func (c *DiscoveryController) JWKS() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		responder.OutputJSON(w, c.keys.PublicKeys())
+	}
+}
+
+// OpenIDConfiguration godoc
+// @Summary Discovery документ
+// @Description Возвращает OpenID Connect discovery документ с издателем токенов и адресом JWKS
+// @Tags discovery
+// @Produce json
+// @Success 200 {object} OpenIDConfiguration
+// @Router /.well-known/openid-configuration [get]
+func (c *DiscoveryController) OpenIDConfiguration() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		responder.OutputJSON(w, OpenIDConfiguration{
+			Issuer:                           c.issuer,
+			JwksURI:                          c.baseURL + "/.well-known/jwks.json",
+			UserinfoEndpoint:                 c.baseURL + "/api/me",
+			IntrospectionEndpoint:            c.baseURL + "/api/token/introspect",
+			ResponseTypesSupported:           []string{"token"},
+			SubjectTypesSupported:            []string{"public"},
+			IDTokenSigningAlgValuesSupported: []string{c.keys.Algorithm()},
+			ClaimsSupported:                  []string{"sub", ClaimUsername, ClaimEmail, "iss", "aud", "iat", ClaimIssuedAtMicros, "nbf", "exp", "jti", ClaimTenant},
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"test/internal/mailer"
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("verification link is invalid or expired")
+	ErrEmailMissing             = errors.New("account has no email address")
+	ErrEmailAlreadyVerified     = errors.New("email address is already verified")
+	ErrEmailNotVerified         = errors.New("email address is not verified")
+	ErrVerificationNotFound     = errors.New("email verification token not found")
+	ErrVerificationUsed         = errors.New("email verification token already used")
+)
+
+// EmailVerification is a single use token mailed to an address to verify
+// it. Only the SHA-256 hash of the token is stored.
+type EmailVerification struct {
+	ID        int64
+	TokenHash string
+	UserID    int64
+	// Email is the address the token was sent to.
+	Email     string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+}
+
+type EmailVerificationRepository interface {
+	Create(ctx context.Context, verification *EmailVerification) error
+	GetByHash(ctx context.Context, hash string) (*EmailVerification, error)
+	// MarkUsed atomically flags the token as used and returns
+	// ErrVerificationUsed if it already was.
+	MarkUsed(ctx context.Context, id int64, at time.Time) error
+	// DeleteExpired drops tokens that expired or were used by now.
+	DeleteExpired(ctx context.Context, now time.Time) error
+}
+
+type MemoryEmailVerificationRepository struct {
+	mu            sync.Mutex
+	lastID        int64
+	verifications map[int64]*EmailVerification
+	byHash        map[string]int64
+}
+
+func NewMemoryEmailVerificationRepository() *MemoryEmailVerificationRepository {
+	return &MemoryEmailVerificationRepository{
+		verifications: make(map[int64]*EmailVerification),
+		byHash:        make(map[string]int64),
+	}
+}
+
+func (r *MemoryEmailVerificationRepository) Create(ctx context.Context, verification *EmailVerification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	verification.ID = r.lastID
+	verification.CreatedAt = time.Now().UTC()
+
+	stored := *verification
+	r.verifications[verification.ID] = &stored
+	r.byHash[verification.TokenHash] = verification.ID
+	return nil
+}
+
+func (r *MemoryEmailVerificationRepository) GetByHash(ctx context.Context, hash string) (*EmailVerification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.byHash[hash]
+	if !ok {
+		return nil, ErrVerificationNotFound
+	}
+	found := *r.verifications[id]
+	return &found, nil
+}
+
+func (r *MemoryEmailVerificationRepository) MarkUsed(ctx context.Context, id int64, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	verification, ok := r.verifications[id]
+	if !ok {
+		return ErrVerificationNotFound
+	}
+	if verification.UsedAt != nil {
+		return ErrVerificationUsed
+	}
+	verification.UsedAt = &at
+	return nil
+}
+
+func (r *MemoryEmailVerificationRepository) DeleteExpired(ctx context.Context, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, verification := range r.verifications {
+		if verification.UsedAt != nil || !now.Before(verification.ExpiresAt) {
+			delete(r.byHash, verification.TokenHash)
+			delete(r.verifications, id)
+		}
+	}
+	return nil
+}
+
+type EmailVerificationConfig struct {
+	TTL time.Duration
+	// URL is the endpoint that accepts the token in the token query
+	// parameter.
+	URL string
+	// ResendInterval is the minimum time between two verification emails to
+	// the same user.
+	ResendInterval time.Duration
+}
+
+// EmailVerificationService mails verification links. A link carries a random
+// single use token bound to the email address it was sent to. Tokens are
+// stored rather than signed, so they stay valid for the whole TTL however
+// often the signing keys rotate.
+type EmailVerificationService struct {
+	mu       sync.Mutex
+	tokens   EmailVerificationRepository
+	users    UserRepository
+	mailer   mailer.Mailer
+	config   EmailVerificationConfig
+	lastSent map[int64]time.Time
+}
+
+func NewEmailVerificationService(tokens EmailVerificationRepository, users UserRepository, mail mailer.Mailer, config EmailVerificationConfig) *EmailVerificationService {
+	return &EmailVerificationService{
+		tokens:   tokens,
+		users:    users,
+		mailer:   mail,
+		config:   config,
+		lastSent: make(map[int64]time.Time),
+	}
+}
+
+// SendAsync mails a verification link to a newly registered user in the
+// background.
+func (s *EmailVerificationService) SendAsync(user *User) {
+	s.mu.Lock()
+	s.lastSent[user.ID] = time.Now()
+	s.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := s.send(ctx, user); err != nil {
+			log.Printf("send verification email to user %d: %v", user.ID, err)
+		}
+	}()
+}
+
+// Resend mails a new verification link unless one was sent less than
+// ResendInterval ago, in which case it returns how long to wait.
+func (s *EmailVerificationService) Resend(ctx context.Context, userID int64) (time.Duration, error) {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if user.EmailVerifiedAt != nil {
+		return 0, ErrEmailAlreadyVerified
+	}
+	if user.Email == "" {
+		return 0, ErrEmailMissing
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	if last, ok := s.lastSent[userID]; ok && now.Sub(last) < s.config.ResendInterval {
+		s.mu.Unlock()
+		return s.config.ResendInterval - now.Sub(last), nil
+	}
+	s.lastSent[userID] = now
+	s.mu.Unlock()
+
+	return 0, s.send(ctx, user)
+}
+
+// Verify marks the email address the link was sent to as verified. Links sent
+// to an address the user has changed since are rejected.
+func (s *EmailVerificationService) Verify(ctx context.Context, raw string) (*User, error) {
+	verification, err := s.tokens.GetByHash(ctx, hashToken(raw))
+	if errors.Is(err, ErrVerificationNotFound) {
+		return nil, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if verification.UsedAt != nil || now.After(verification.ExpiresAt) {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	user, err := s.users.GetByID(ctx, verification.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Email != verification.Email {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	if err := s.tokens.MarkUsed(ctx, verification.ID, now); err != nil {
+		if errors.Is(err, ErrVerificationUsed) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, err
+	}
+	if user.EmailVerifiedAt != nil {
+		return user, nil
+	}
+	user.EmailVerifiedAt = &now
+	if err := s.users.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Cleanup drops expired and used tokens and forgets resend times that no
+// longer limit anything.
+func (s *EmailVerificationService) Cleanup(ctx context.Context) {
+	now := time.Now()
+	if err := s.tokens.DeleteExpired(ctx, now.UTC()); err != nil {
+		log.Println("email verification cleanup:", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for userID, last := range s.lastSent {
+		if now.Sub(last) >= s.config.ResendInterval {
+			delete(s.lastSent, userID)
+		}
+	}
+}
+
+// StartCleanup runs Cleanup every interval until ctx is done.
+func (s *EmailVerificationService) StartCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Cleanup(ctx)
+		}
+	}
+}
+
+func (s *EmailVerificationService) send(ctx context.Context, user *User) error {
+	if user.Email == "" {
+		return ErrEmailMissing
+	}
+
+	raw, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	err = s.tokens.Create(ctx, &EmailVerification{
+		TokenHash: hashToken(raw),
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().UTC().Add(s.config.TTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.config.URL + "?token=" + url.QueryEscape(raw)
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Подтверждение email",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\nПодтвердите адрес электронной почты, перейдя по ссылке:\n%s\n\n"+
+			"Ссылка действительна %d ч. Если вы не регистрировались, просто проигнорируйте это письмо.\n",
+			user.Username, link, int(s.config.TTL.Hours())),
+	})
+}
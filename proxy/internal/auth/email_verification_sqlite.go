@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"test/internal/database"
+)
+
+var emailVerificationMigrations = []string{
+	`CREATE TABLE email_verifications (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		token_hash TEXT NOT NULL UNIQUE,
+		user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		email      TEXT NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		used_at    TIMESTAMP
+	)`,
+	`CREATE INDEX email_verifications_user_id ON email_verifications (user_id)`,
+}
+
+type SQLiteEmailVerificationRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteEmailVerificationRepository(db *sql.DB) (*SQLiteEmailVerificationRepository, error) {
+	if err := database.Migrate(db, "email_verifications", emailVerificationMigrations); err != nil {
+		return nil, err
+	}
+	return &SQLiteEmailVerificationRepository{db: db}, nil
+}
+
+func (r *SQLiteEmailVerificationRepository) Create(ctx context.Context, verification *EmailVerification) error {
+	verification.CreatedAt = time.Now().UTC()
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO email_verifications (token_hash, user_id, email, expires_at, created_at) VALUES (?, ?, ?, ?, ?)`,
+		verification.TokenHash, verification.UserID, verification.Email, verification.ExpiresAt.UTC(), verification.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	verification.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *SQLiteEmailVerificationRepository) GetByHash(ctx context.Context, hash string) (*EmailVerification, error) {
+	var verification EmailVerification
+	var usedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, token_hash, user_id, email, expires_at, created_at, used_at FROM email_verifications WHERE token_hash = ?`, hash,
+	).Scan(&verification.ID, &verification.TokenHash, &verification.UserID, &verification.Email,
+		&verification.ExpiresAt, &verification.CreatedAt, &usedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrVerificationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		verification.UsedAt = &usedAt.Time
+	}
+	return &verification, nil
+}
+
+func (r *SQLiteEmailVerificationRepository) MarkUsed(ctx context.Context, id int64, at time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE email_verifications SET used_at = ? WHERE id = ? AND used_at IS NULL`, at.UTC(), id,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVerificationUsed
+	}
+	return nil
+}
+
+func (r *SQLiteEmailVerificationRepository) DeleteExpired(ctx context.Context, now time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`DELETE FROM email_verifications WHERE expires_at <= ? OR used_at IS NOT NULL`, now.UTC(),
+	)
+	return err
+}
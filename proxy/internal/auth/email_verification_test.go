@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"test/internal/database"
+	"test/internal/mailer"
+)
+
+type recordingMailer struct {
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`\?token=(\S+)`)
+
+// lastToken returns the token of the link in the last mailed message.
+func (m *recordingMailer) lastToken(t *testing.T) string {
+	t.Helper()
+	if len(m.messages) == 0 {
+		t.Fatal("no message was sent")
+	}
+	match := linkToken.FindStringSubmatch(m.messages[len(m.messages)-1].Body)
+	if match == nil {
+		t.Fatal("message has no link")
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestEmailVerificationLinkIsSingleUse(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	user := &User{Username: "alice", Email: "alice@example.com"}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	mail := &recordingMailer{}
+	s := NewEmailVerificationService(NewMemoryEmailVerificationRepository(), users, mail, EmailVerificationConfig{
+		TTL: 48 * time.Hour,
+		URL: "http://localhost/api/email/verify",
+	})
+
+	if _, err := s.Resend(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	token := mail.lastToken(t)
+	verified, err := s.Verify(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified.EmailVerifiedAt == nil {
+		t.Error("email was not marked as verified")
+	}
+	if _, err := s.Verify(ctx, token); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("second use: got %v, want %v", err, ErrInvalidVerificationToken)
+	}
+}
+
+func TestEmailVerificationLinkIsBoundToAddress(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	user := &User{Username: "alice", Email: "alice@example.com"}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	mail := &recordingMailer{}
+	s := NewEmailVerificationService(NewMemoryEmailVerificationRepository(), users, mail, EmailVerificationConfig{
+		TTL: 48 * time.Hour,
+		URL: "http://localhost/api/email/verify",
+	})
+	if _, err := s.Resend(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	user.Email = "mallory@example.com"
+	if err := users.Update(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Verify(ctx, mail.lastToken(t)); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("got %v, want %v", err, ErrInvalidVerificationToken)
+	}
+}
+
+func TestEmailVerificationDeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	users, err := NewSQLiteUserRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &User{Username: "alice", Email: "alice@example.com"}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	sqlite, err := NewSQLiteEmailVerificationRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, repo := range map[string]EmailVerificationRepository{
+		"memory": NewMemoryEmailVerificationRepository(),
+		"sqlite": sqlite,
+	} {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now().UTC()
+			create := func(hash string, expiresAt time.Time) *EmailVerification {
+				verification := &EmailVerification{TokenHash: hash, UserID: user.ID, Email: user.Email, ExpiresAt: expiresAt}
+				if err := repo.Create(ctx, verification); err != nil {
+					t.Fatal(err)
+				}
+				return verification
+			}
+			create(name+"-expired", now.Add(-time.Minute))
+			used := create(name+"-used", now.Add(time.Hour))
+			if err := repo.MarkUsed(ctx, used.ID, now); err != nil {
+				t.Fatal(err)
+			}
+			create(name+"-valid", now.Add(time.Hour))
+
+			if err := repo.DeleteExpired(ctx, now); err != nil {
+				t.Fatal(err)
+			}
+			for _, hash := range []string{name + "-expired", name + "-used"} {
+				if _, err := repo.GetByHash(ctx, hash); !errors.Is(err, ErrVerificationNotFound) {
+					t.Errorf("%s: got %v, want it deleted", hash, err)
+				}
+			}
+			if _, err := repo.GetByHash(ctx, name+"-valid"); err != nil {
+				t.Errorf("valid token: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"strings"
+)
+
+const (
+	TokenTypeAccess   = "access_token"
+	TokenTypeAPIKey   = "api_key"
+	TokenTypePersonal = "personal_access_token"
+)
+
+// IntrospectionService tells other services whether a token issued by this
+// one is still active (RFC 7662). Only the configured clients may ask.
+type IntrospectionService struct {
+	codec    TokenCodec
+	denylist *Denylist
+	users    UserRepository
+	apiKeys  *APIKeyService
+	personal *PersonalTokenService
+	// clients maps client IDs to the SHA-256 hashes of their secrets.
+	clients map[string][]byte
+}
+
+// NewIntrospectionService creates the service for clients given as client
+// ID to secret.
+func NewIntrospectionService(codec TokenCodec, denylist *Denylist, users UserRepository, apiKeys *APIKeyService, personal *PersonalTokenService, clients map[string]string) *IntrospectionService {
+	hashed := make(map[string][]byte, len(clients))
+	for id, secret := range clients {
+		sum := sha256.Sum256([]byte(secret))
+		hashed[id] = sum[:]
+	}
+	return &IntrospectionService{
+		codec:    codec,
+		denylist: denylist,
+		users:    users,
+		apiKeys:  apiKeys,
+		personal: personal,
+		clients:  hashed,
+	}
+}
+
+// AuthenticateClient reports whether the client credentials are valid.
+func (s *IntrospectionService) AuthenticateClient(clientID, secret string) bool {
+	expected, ok := s.clients[clientID]
+	sum := sha256.Sum256([]byte(secret))
+	// The secret is compared even for unknown clients, so the response time
+	// does not tell which client IDs exist.
+	if !ok {
+		expected = make([]byte, sha256.Size)
+	}
+	return subtle.ConstantTimeCompare(sum[:], expected) == 1 && ok
+}
+
+// Introspect describes the token. Tokens that are malformed, expired,
+// revoked or belong to a disabled or deleted user are reported as inactive.
+// hint is the token_type_hint of the request and only decides which kind of
+// token is tried first.
+func (s *IntrospectionService) Introspect(ctx context.Context, raw, hint string) (IntrospectionResponse, error) {
+	if isPersonalToken(raw) {
+		return s.introspectPersonalToken(ctx, raw)
+	}
+	if hint == TokenTypeAPIKey || apiKeyKind.matches(raw) {
+		res, err := s.introspectAPIKey(ctx, raw)
+		if err != nil || res.Active {
+			return res, err
+		}
+	}
+	return s.introspectAccessToken(ctx, raw)
+}
+
+func (s *IntrospectionService) introspectAccessToken(ctx context.Context, raw string) (IntrospectionResponse, error) {
+	token, err := verifyToken(s.codec, raw)
+	if err != nil {
+		return IntrospectionResponse{}, nil
+	}
+	claims := ClaimsFromToken(token)
+	if s.denylist.IsRevoked(claims.TokenID, claims.UserID(), claims.IssuedAt) {
+		return IntrospectionResponse{}, nil
+	}
+	if active, err := s.userActive(ctx, claims.UserID()); err != nil || !active {
+		return IntrospectionResponse{}, err
+	}
+
+	res := introspectionClaims(claims, TokenTypeAccess)
+	res.Issuer = claims.Issuer
+	res.Audience = claims.Audience
+	res.TokenID = claims.TokenID
+	res.IssuedAt = claims.IssuedAt.Unix()
+	res.ExpiresAt = claims.ExpiresAt.Unix()
+	if nbf := token.NotBefore(); !nbf.IsZero() {
+		res.NotBefore = nbf.Unix()
+	}
+	return res, nil
+}
+
+func (s *IntrospectionService) introspectAPIKey(ctx context.Context, raw string) (IntrospectionResponse, error) {
+	claims, err := s.apiKeys.Authenticate(ctx, raw)
+	if errors.Is(err, ErrInvalidAPIKey) {
+		return IntrospectionResponse{}, nil
+	}
+	if err != nil {
+		return IntrospectionResponse{}, err
+	}
+	if active, err := s.userActive(ctx, claims.UserID()); err != nil || !active {
+		return IntrospectionResponse{}, err
+	}
+	return introspectionClaims(claims, TokenTypeAPIKey), nil
+}
+
+func (s *IntrospectionService) introspectPersonalToken(ctx context.Context, raw string) (IntrospectionResponse, error) {
+	claims, err := s.personal.Authenticate(ctx, raw)
+	if errors.Is(err, ErrInvalidPersonalToken) {
+		return IntrospectionResponse{}, nil
+	}
+	if err != nil {
+		return IntrospectionResponse{}, err
+	}
+	if active, err := s.userActive(ctx, claims.UserID()); err != nil || !active {
+		return IntrospectionResponse{}, err
+	}
+
+	res := introspectionClaims(claims, TokenTypePersonal)
+	res.IssuedAt = claims.IssuedAt.Unix()
+	if !claims.ExpiresAt.IsZero() {
+		res.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	return res, nil
+}
+
+func (s *IntrospectionService) userActive(ctx context.Context, userID int64) (bool, error) {
+	user, err := s.users.GetByID(ctx, userID)
+	if errors.Is(err, ErrUserNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return user.DisabledAt == nil, nil
+}
+
+func introspectionClaims(claims *Claims, tokenType string) IntrospectionResponse {
+	return IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(claims.Permissions, " "),
+		Subject:   claims.Subject,
+		Username:  claims.Username,
+		TokenType: tokenType,
+		TenantID:  claims.TenantID,
+	}
+}
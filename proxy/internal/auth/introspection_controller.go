@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"test/internal/responder"
+)
+
+type IntrospectionController struct {
+	introspection *IntrospectionService
+}
+
+func NewIntrospectionController(introspection *IntrospectionService) *IntrospectionController {
+	return &IntrospectionController{introspection: introspection}
+}
+
+// Introspect godoc
+// @Summary Проверка токена (RFC 7662)
+// @Description Сообщает другим сервисам, действует ли access токен, API ключ или персональный токен, с учетом отзыва токенов и отключения учетных записей. Клиент передает client_id и client_secret в заголовке Basic или в теле запроса. Для недействительного токена возвращается только "active": false
+// @Tags auth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Security BasicAuth
+// @Param token formData string true "Токен"
+// @Param token_type_hint formData string false "Тип токена: access_token, api_key или personal_access_token"
+// @Success 200 {object} IntrospectionResponse "Состояние токена"
+// @Failure 400 {object} IntrospectionError "Токен не передан"
+// @Failure 401 {object} IntrospectionError "Неверные учетные данные клиента"
+// @Failure 500 {object} IntrospectionError "Внутренняя ошибка сервера"
+// @Router /token/introspect [post]
+func (c *IntrospectionController) Introspect() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			outputIntrospectionError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+
+		clientID, secret, ok := r.BasicAuth()
+		if !ok {
+			clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		}
+		if !c.introspection.AuthenticateClient(clientID, secret) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="introspection"`)
+			outputIntrospectionError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+			return
+		}
+
+		token := r.PostForm.Get("token")
+		if token == "" {
+			outputIntrospectionError(w, http.StatusBadRequest, "invalid_request", "token is required")
+			return
+		}
+
+		res, err := c.introspection.Introspect(r.Context(), token, r.PostForm.Get("token_type_hint"))
+		if err != nil {
+			log.Println("introspect token:", err)
+			outputIntrospectionError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		responder.OutputJSON(w, res)
+	}
+}
+
+func outputIntrospectionError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(IntrospectionError{Error: code, Description: description}); err != nil {
+		log.Println("response writer error on write:", err)
+	}
+}
@@ -0,0 +1,493 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const keyRingManifest = "keyring.json"
+
+const (
+	KeyStatusPending     = "pending"
+	KeyStatusActive      = "active"
+	KeyStatusDeactivated = "deactivated"
+)
+
+// TokenCodec signs and parses JWTs. It is implemented by *KeyRing and has the
+// same shape as *jwtauth.JWTAuth.
+type TokenCodec interface {
+	Encode(claims map[string]interface{}) (jwt.Token, string, error)
+	Decode(tokenString string) (jwt.Token, error)
+	ValidateOptions() []jwt.ValidateOption
+}
+
+// encodeWithAudience signs one of the service's own short-lived tokens, e.g.
+// an MFA challenge. Its audience differs from the one of access tokens, so
+// neither is accepted in place of the other.
+func encodeWithAudience(codec TokenCodec, audience string, claims TokenClaims) (string, error) {
+	claims["aud"] = audience
+	_, raw, err := codec.Encode(claims)
+	return raw, err
+}
+
+// decodeWithAudience decodes a token made by encodeWithAudience.
+func decodeWithAudience(codec TokenCodec, raw, issuer, audience string) (jwt.Token, error) {
+	token, err := codec.Decode(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := jwt.Validate(token, jwt.WithIssuer(issuer), jwt.WithAudience(audience)); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+type KeyRingConfig struct {
+	Algorithm string
+	// Dir holds one file per key (<kid>.pem, or <kid>.key for HS256) and the
+	// keyring.json manifest with their lifecycle timestamps.
+	Dir string
+	// RotationInterval is how long a key signs tokens before the next one is
+	// promoted. Zero disables scheduled rotation.
+	RotationInterval time.Duration
+	// MaxTokenLifetime is how long a demoted key keeps verifying tokens it
+	// signed before it is retired. It must cover the longest lived token the
+	// ring signs: access tokens, MFA challenges and OIDC login state.
+	MaxTokenLifetime time.Duration
+	ValidateOptions  []jwt.ValidateOption
+}
+
+// KeyInfo describes a key of the ring for the admin API.
+type KeyInfo struct {
+	KeyID         string     `json:"kid"`
+	Algorithm     string     `json:"alg"`
+	Status        string     `json:"status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ActivatedAt   *time.Time `json:"activated_at,omitempty"`
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+	RetiresAt     *time.Time `json:"retires_at,omitempty"`
+}
+
+type keyEntry struct {
+	KeyID         string     `json:"kid"`
+	File          string     `json:"file"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ActivatedAt   *time.Time `json:"activated_at,omitempty"`
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+
+	key *SigningKey
+}
+
+func (e *keyEntry) status() string {
+	switch {
+	case e.ActivatedAt == nil:
+		return KeyStatusPending
+	case e.DeactivatedAt == nil:
+		return KeyStatusActive
+	default:
+		return KeyStatusDeactivated
+	}
+}
+
+// KeyRing holds the key that signs new tokens and every key whose tokens may
+// still be in circulation. Tokens carry the kid of their signing key, so keys
+// can be rotated without invalidating tokens signed by the previous one.
+//
+// Pending keys are published in the JWKS before they start signing so that
+// verifiers caching the key set already know them once they are promoted.
+type KeyRing struct {
+	mu      sync.RWMutex
+	config  KeyRingConfig
+	entries []*keyEntry
+	signing *SigningKey
+	verify  jwk.Set
+	public  jwk.Set
+}
+
+// NewStaticKeyRing returns a ring with a single key that is never rotated.
+func NewStaticKeyRing(key *SigningKey, validateOptions ...jwt.ValidateOption) (*KeyRing, error) {
+	now := time.Now().UTC()
+	ring := &KeyRing{
+		config: KeyRingConfig{Algorithm: key.Algorithm, ValidateOptions: validateOptions},
+		entries: []*keyEntry{{
+			KeyID:       key.KeyID,
+			CreatedAt:   now,
+			ActivatedAt: &now,
+			key:         key,
+		}},
+	}
+	if err := ring.rebuild(); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// OpenKeyRing loads the ring stored in config.Dir, creating the first key
+// when the directory is empty.
+func OpenKeyRing(config KeyRingConfig) (*KeyRing, error) {
+	if err := os.MkdirAll(config.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	ring := &KeyRing{config: config}
+	if err := ring.Reload(); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+func (k *KeyRing) Encode(claims map[string]interface{}) (jwt.Token, string, error) {
+	k.mu.RLock()
+	signing := k.signing
+	k.mu.RUnlock()
+
+	token := jwt.New()
+	for name, value := range claims {
+		if err := token.Set(name, value); err != nil {
+			return nil, "", err
+		}
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.SignatureAlgorithm(signing.Algorithm), signing.Private))
+	if err != nil {
+		return nil, "", err
+	}
+	return token, string(signed), nil
+}
+
+// Decode verifies the signature of tokenString against the key named by its
+// kid header. A token without kid is only accepted while the ring has a
+// single key, which keeps tokens issued before key IDs were introduced valid.
+func (k *KeyRing) Decode(tokenString string) (jwt.Token, error) {
+	k.mu.RLock()
+	verify := k.verify
+	k.mu.RUnlock()
+
+	return jwt.Parse([]byte(tokenString),
+		jwt.WithKeySet(verify, jws.WithRequireKid(true), jws.WithUseDefault(true)),
+		jwt.WithValidate(false),
+	)
+}
+
+func (k *KeyRing) ValidateOptions() []jwt.ValidateOption {
+	return k.config.ValidateOptions
+}
+
+// Dynamic reports whether the ring is backed by a key directory and can be
+// reloaded and rotated.
+func (k *KeyRing) Dynamic() bool {
+	return k.config.Dir != ""
+}
+
+func (k *KeyRing) Algorithm() string {
+	return k.config.Algorithm
+}
+
+// PublicKeys returns the JWKS of every non retired asymmetric key.
+func (k *KeyRing) PublicKeys() jwk.Set {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.public
+}
+
+func (k *KeyRing) Keys() []KeyInfo {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	res := make([]KeyInfo, 0, len(k.entries))
+	for _, e := range k.entries {
+		info := KeyInfo{
+			KeyID:         e.KeyID,
+			Algorithm:     e.key.Algorithm,
+			Status:        e.status(),
+			CreatedAt:     e.CreatedAt,
+			ActivatedAt:   e.ActivatedAt,
+			DeactivatedAt: e.DeactivatedAt,
+		}
+		if e.DeactivatedAt != nil && k.config.Dir != "" {
+			retiresAt := e.DeactivatedAt.Add(k.config.MaxTokenLifetime)
+			info.RetiresAt = &retiresAt
+		}
+		res = append(res, info)
+	}
+	return res
+}
+
+// Reload re-reads the key directory. Key files that are not in the manifest
+// yet are added as pending keys; manifest entries whose file was removed are
+// dropped.
+func (k *KeyRing) Reload() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.config.Dir == "" {
+		return errors.New("static key ring can not be reloaded")
+	}
+
+	manifest, err := k.readManifest()
+	if err != nil {
+		return err
+	}
+	known := make(map[string]*keyEntry, len(manifest))
+	for _, e := range manifest {
+		known[e.File] = e
+	}
+
+	files, err := os.ReadDir(k.config.Dir)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	var entries []*keyEntry
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || (filepath.Ext(name) != ".pem" && filepath.Ext(name) != ".key") {
+			continue
+		}
+		entry, ok := known[name]
+		if !ok {
+			entry = &keyEntry{KeyID: strings.TrimSuffix(name, filepath.Ext(name)), File: name, CreatedAt: now}
+		}
+		entry.key, err = k.loadKeyFile(name, entry.KeyID)
+		if err != nil {
+			return fmt.Errorf("load key %s: %w", name, err)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+	k.entries = entries
+
+	if k.activeEntry() == nil {
+		if err := k.rotate(now); err != nil {
+			return err
+		}
+	}
+	return k.commit()
+}
+
+// Rotate promotes the oldest pending key, generating one if there is none,
+// and demotes the current signing key to verification only.
+func (k *KeyRing) Rotate() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.config.Dir == "" {
+		return errors.New("static key ring can not be rotated")
+	}
+	if err := k.rotate(time.Now().UTC()); err != nil {
+		return err
+	}
+	return k.commit()
+}
+
+// Maintain applies the rotation schedule: it pre-publishes the next key
+// halfway through the rotation interval, promotes it when the interval is
+// over and retires demoted keys once every token they signed has expired.
+func (k *KeyRing) Maintain() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.config.Dir == "" {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	changed := false
+	if interval := k.config.RotationInterval; interval > 0 {
+		active := k.activeEntry()
+		switch {
+		case active == nil || !now.Before(active.ActivatedAt.Add(interval)):
+			if err := k.rotate(now); err != nil {
+				return err
+			}
+			changed = true
+		case k.pendingEntry() == nil && !now.Before(active.ActivatedAt.Add(interval/2)):
+			if _, err := k.generate(now); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+
+	kept := k.entries[:0]
+	for _, e := range k.entries {
+		if e.DeactivatedAt != nil && !now.Before(e.DeactivatedAt.Add(k.config.MaxTokenLifetime)) {
+			log.Printf("retiring signing key %s", e.KeyID)
+			if err := os.Remove(filepath.Join(k.config.Dir, e.File)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			changed = true
+			continue
+		}
+		kept = append(kept, e)
+	}
+	k.entries = kept
+
+	if !changed {
+		return nil
+	}
+	return k.commit()
+}
+
+// StartRotation runs Maintain every interval until ctx is done.
+func (k *KeyRing) StartRotation(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.Maintain(); err != nil {
+				log.Println("key rotation:", err)
+			}
+		}
+	}
+}
+
+func (k *KeyRing) rotate(now time.Time) error {
+	next := k.pendingEntry()
+	if next == nil {
+		var err error
+		if next, err = k.generate(now); err != nil {
+			return err
+		}
+	}
+	if active := k.activeEntry(); active != nil {
+		active.DeactivatedAt = &now
+	}
+	next.ActivatedAt = &now
+	log.Printf("signing key %s promoted", next.KeyID)
+	return nil
+}
+
+func (k *KeyRing) generate(now time.Time) (*keyEntry, error) {
+	suffix, err := randomToken(4)
+	if err != nil {
+		return nil, err
+	}
+	kid := now.Format("20060102T150405Z") + "-" + suffix
+	key, encoded, err := generateSigningKey(k.config.Algorithm, kid)
+	if err != nil {
+		return nil, err
+	}
+
+	file := kid + ".pem"
+	if !IsAsymmetric(k.config.Algorithm) {
+		file = kid + ".key"
+	}
+	if err := os.WriteFile(filepath.Join(k.config.Dir, file), encoded, 0o600); err != nil {
+		return nil, err
+	}
+
+	entry := &keyEntry{KeyID: kid, File: file, CreatedAt: now, key: key}
+	k.entries = append(k.entries, entry)
+	return entry, nil
+}
+
+func (k *KeyRing) activeEntry() *keyEntry {
+	var active *keyEntry
+	for _, e := range k.entries {
+		if e.status() == KeyStatusActive && (active == nil || e.ActivatedAt.After(*active.ActivatedAt)) {
+			active = e
+		}
+	}
+	return active
+}
+
+func (k *KeyRing) pendingEntry() *keyEntry {
+	for _, e := range k.entries {
+		if e.status() == KeyStatusPending {
+			return e
+		}
+	}
+	return nil
+}
+
+func (k *KeyRing) loadKeyFile(name, kid string) (*SigningKey, error) {
+	data, err := os.ReadFile(filepath.Join(k.config.Dir, name))
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(name) == ".key" {
+		if IsAsymmetric(k.config.Algorithm) {
+			return nil, fmt.Errorf("HMAC key can not be used with %s", k.config.Algorithm)
+		}
+		return newHMACKey([]byte(strings.TrimSpace(string(data))), kid)
+	}
+	return parseSigningKey(k.config.Algorithm, data, kid)
+}
+
+func (k *KeyRing) readManifest() ([]*keyEntry, error) {
+	data, err := os.ReadFile(filepath.Join(k.config.Dir, keyRingManifest))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*keyEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", keyRingManifest, err)
+	}
+	return entries, nil
+}
+
+// commit persists the manifest and swaps in the new key sets.
+func (k *KeyRing) commit() error {
+	data, err := json.MarshalIndent(k.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(k.config.Dir, keyRingManifest+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(k.config.Dir, keyRingManifest)); err != nil {
+		return err
+	}
+	return k.rebuild()
+}
+
+func (k *KeyRing) rebuild() error {
+	active := k.activeEntry()
+	if active == nil {
+		return errors.New("key ring has no active signing key")
+	}
+
+	verify := jwk.NewSet()
+	public := jwk.NewSet()
+	for _, e := range k.entries {
+		if e.status() != KeyStatusPending {
+			verifyKey := e.key.Private
+			if e.key.Public != nil {
+				verifyKey = e.key.Public
+			}
+			if err := verify.AddKey(verifyKey); err != nil {
+				return err
+			}
+		}
+		if e.key.Public != nil {
+			if err := public.AddKey(e.key.Public); err != nil {
+				return err
+			}
+		}
+	}
+
+	k.signing = active.key
+	k.verify = verify
+	k.public = public
+	return nil
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// SigningKey is the key material tokens are signed and verified with. For
+// HMAC algorithms Public is nil, since a symmetric key must never be
+// published.
+type SigningKey struct {
+	Algorithm string
+	KeyID     string
+	Private   jwk.Key
+	Public    jwk.Key
+}
+
+// IsAsymmetric reports whether alg is one of the supported public key
+// algorithms.
+func IsAsymmetric(alg string) bool {
+	switch jwa.SignatureAlgorithm(alg) {
+	case jwa.RS256, jwa.ES256, jwa.EdDSA:
+		return true
+	}
+	return false
+}
+
+// LoadSigningKey returns the signing key for alg. HS256 uses secret, RS256,
+// ES256 and EdDSA read a PEM encoded private key from pemPath. The key ID
+// of an asymmetric key is the RFC 7638 thumbprint of the public key unless
+// kid is given.
+func LoadSigningKey(alg, secret, pemPath, kid string) (*SigningKey, error) {
+	if jwa.SignatureAlgorithm(alg) == jwa.HS256 {
+		if secret == "" {
+			return nil, errors.New("HS256 requires a secret")
+		}
+		return newHMACKey([]byte(secret), kid)
+	}
+	if !IsAsymmetric(alg) {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+
+	data, err := os.ReadFile(pemPath)
+	if err != nil {
+		return nil, err
+	}
+	return parseSigningKey(alg, data, kid)
+}
+
+func newHMACKey(secret []byte, kid string) (*SigningKey, error) {
+	private, err := jwk.FromRaw(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := private.Set(jwk.AlgorithmKey, jwa.HS256); err != nil {
+		return nil, err
+	}
+	if kid != "" {
+		if err := private.Set(jwk.KeyIDKey, kid); err != nil {
+			return nil, err
+		}
+	}
+	return &SigningKey{Algorithm: string(jwa.HS256), KeyID: kid, Private: private}, nil
+}
+
+func parseSigningKey(alg string, pemData []byte, kid string) (*SigningKey, error) {
+	private, err := jwk.ParseKey(pemData, jwk.WithPEM(true))
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	if isPrivate, err := jwk.IsPrivateKey(private); err != nil || !isPrivate {
+		return nil, errors.New("PEM file does not contain a private key")
+	}
+
+	var raw interface{}
+	if err := private.Raw(&raw); err != nil {
+		return nil, err
+	}
+	if err := checkKeyType(alg, raw); err != nil {
+		return nil, err
+	}
+
+	if kid != "" {
+		err = private.Set(jwk.KeyIDKey, kid)
+	} else {
+		err = jwk.AssignKeyID(private)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := private.Set(jwk.AlgorithmKey, jwa.SignatureAlgorithm(alg)); err != nil {
+		return nil, err
+	}
+
+	public, err := private.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := public.Set(jwk.KeyUsageKey, jwk.ForSignature); err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{Algorithm: alg, KeyID: private.KeyID(), Private: private, Public: public}, nil
+}
+
+// generateSigningKey creates a new random key for alg and returns it together
+// with its file encoding: a PKCS #8 PEM block for asymmetric keys and a
+// base64 string for HMAC secrets.
+func generateSigningKey(alg, kid string) (*SigningKey, []byte, error) {
+	var raw interface{}
+	var err error
+	switch jwa.SignatureAlgorithm(alg) {
+	case jwa.HS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, nil, err
+		}
+		encoded := []byte(base64.RawURLEncoding.EncodeToString(secret))
+		key, err := newHMACKey(encoded, kid)
+		return key, encoded, err
+	case jwa.RS256:
+		raw, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwa.ES256:
+		raw, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwa.EdDSA:
+		_, raw, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	key, err := parseSigningKey(alg, encoded, kid)
+	return key, encoded, err
+}
+
+func checkKeyType(alg string, raw interface{}) error {
+	switch jwa.SignatureAlgorithm(alg) {
+	case jwa.RS256:
+		if key, ok := raw.(*rsa.PrivateKey); ok {
+			if key.N.BitLen() < 2048 {
+				return errors.New("RS256 requires an RSA key of at least 2048 bits")
+			}
+			return nil
+		}
+	case jwa.ES256:
+		if key, ok := raw.(*ecdsa.PrivateKey); ok {
+			if key.Curve != elliptic.P256() {
+				return errors.New("ES256 requires an EC key on the P-256 curve")
+			}
+			return nil
+		}
+	case jwa.EdDSA:
+		if _, ok := raw.(ed25519.PrivateKey); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("private key of type %T can not be used with %s", raw, alg)
+}
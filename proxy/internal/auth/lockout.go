@@ -0,0 +1,328 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"test/internal/audit"
+)
+
+const (
+	LockoutUsername = "username"
+	LockoutIP       = "ip"
+)
+
+// defaultMaxTracked is the default LockoutConfig.MaxTracked.
+const defaultMaxTracked = 100000
+
+var ErrLoginLocked = errors.New("too many failed login attempts, try again later")
+
+type LockoutConfig struct {
+	// MaxFailures is the number of failed logins for one username after
+	// which it is locked.
+	MaxFailures int
+	// MaxFailuresPerIP is the same limit for one client address, across all
+	// usernames.
+	MaxFailuresPerIP int
+	// BaseLockout is the first lockout window. Every further failure doubles
+	// it up to MaxLockout.
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	// ResetAfter forgets failures after this long without a new one.
+	ResetAfter time.Duration
+	// MaxTracked caps the number of usernames and addresses with failures
+	// kept in memory, so a spray of random usernames can not exhaust it.
+	// While the table is full, logins for usernames and addresses it does
+	// not track are throttled for BaseLockout. Zero means defaultMaxTracked.
+	MaxTracked int
+}
+
+// Lockout describes a username or client address that is currently locked.
+type Lockout struct {
+	Kind        string    `json:"kind" example:"username"`
+	Subject     string    `json:"subject" example:"user"`
+	Failures    int       `json:"failures" example:"5"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+type loginAttempts struct {
+	key         string
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+	// elem is the place of the entry in LoginGuard.order.
+	elem *list.Element
+}
+
+// LoginGuard counts failed logins per username and per client address and
+// locks them out for exponentially growing windows. Usernames are tracked
+// whether or not they exist, so a lockout does not reveal registered users.
+type LoginGuard struct {
+	mu       sync.Mutex
+	config   LockoutConfig
+	audit    audit.Logger
+	attempts map[string]*loginAttempts
+	// order holds the entries by their last failure, oldest first.
+	order *list.List
+}
+
+func NewLoginGuard(config LockoutConfig, auditLog audit.Logger) *LoginGuard {
+	if config.MaxTracked <= 0 {
+		config.MaxTracked = defaultMaxTracked
+	}
+	return &LoginGuard{
+		config:   config,
+		audit:    auditLog,
+		attempts: make(map[string]*loginAttempts),
+		order:    list.New(),
+	}
+}
+
+// Check returns how long logins for username from ip remain locked, or zero.
+func (g *LoginGuard) Check(username, ip string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	for _, limit := range g.limits(username, ip) {
+		a, ok := g.attempts[lockoutKey(limit.kind, limit.subject)]
+		if !ok {
+			if limit.max > 0 && !g.hasRoom(now) && g.config.BaseLockout > wait {
+				wait = g.config.BaseLockout
+			}
+			continue
+		}
+		if d := a.lockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+type lockoutLimit struct {
+	kind, subject string
+	max           int
+}
+
+func (g *LoginGuard) limits(username, ip string) []lockoutLimit {
+	return []lockoutLimit{
+		{LockoutUsername, normalizeUsername(username), g.config.MaxFailures},
+		{LockoutIP, ip, g.config.MaxFailuresPerIP},
+	}
+}
+
+// Failure records a failed login and returns the lockout window it started,
+// or zero if neither the username nor the address is locked by it.
+func (g *LoginGuard) Failure(ctx context.Context, username, ip string) time.Duration {
+	g.mu.Lock()
+	now := time.Now()
+	var wait time.Duration
+	var events []audit.Event
+	for _, limit := range g.limits(username, ip) {
+		key := lockoutKey(limit.kind, limit.subject)
+		a, ok := g.attempts[key]
+		switch {
+		case !ok && !g.hasRoom(now):
+			// Dropping other entries would reset the counters of
+			// accounts under attack, so the new one is throttled instead.
+			if limit.max > 0 && g.config.BaseLockout > wait {
+				wait = g.config.BaseLockout
+			}
+			continue
+		case !ok:
+			a = &loginAttempts{key: key}
+			a.elem = g.order.PushBack(a)
+			g.attempts[key] = a
+		case now.Sub(a.lastFailure) > g.config.ResetAfter:
+			a.failures = 0
+			a.lockedUntil = time.Time{}
+		}
+		a.failures++
+		a.lastFailure = now
+		g.order.MoveToBack(a.elem)
+		if limit.max <= 0 || a.failures < limit.max {
+			continue
+		}
+
+		d := g.lockoutWindow(a.failures - limit.max)
+		a.lockedUntil = now.Add(d)
+		if d > wait {
+			wait = d
+		}
+		events = append(events, audit.Event{
+			Time:     now.UTC(),
+			Type:     audit.EventLoginLockout,
+			Username: username,
+			IP:       ip,
+			Details: map[string]string{
+				"kind":         limit.kind,
+				"subject":      limit.subject,
+				"failures":     strconv.Itoa(a.failures),
+				"locked_until": a.lockedUntil.UTC().Format(time.RFC3339),
+			},
+		})
+	}
+	g.mu.Unlock()
+
+	for _, event := range events {
+		g.record(ctx, event)
+	}
+	return wait
+}
+
+// Success forgets the failures of the username. Failures of the address are
+// kept, so one valid account can not be used to reset them.
+func (g *LoginGuard) Success(username string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.forget(lockoutKey(LockoutUsername, username))
+}
+
+// Unlock clears the failures of a username or client address. It reports
+// false if there was nothing to clear.
+func (g *LoginGuard) Unlock(ctx context.Context, kind, subject, by string) bool {
+	if kind == LockoutUsername {
+		subject = normalizeUsername(subject)
+	}
+	key := lockoutKey(kind, subject)
+
+	g.mu.Lock()
+	ok := g.forget(key)
+	g.mu.Unlock()
+
+	if ok {
+		g.record(ctx, audit.Event{
+			Type:    audit.EventLoginUnlock,
+			Details: map[string]string{"kind": kind, "subject": subject, "by": by},
+		})
+	}
+	return ok
+}
+
+// Lockouts lists the usernames and addresses that are locked right now.
+func (g *LoginGuard) Lockouts() []Lockout {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	res := []Lockout{}
+	for key, a := range g.attempts {
+		if !a.lockedUntil.After(now) {
+			continue
+		}
+		kind, subject, _ := strings.Cut(key, ":")
+		res = append(res, Lockout{Kind: kind, Subject: subject, Failures: a.failures, LockedUntil: a.lockedUntil.UTC()})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].LockedUntil.Before(res[j].LockedUntil) })
+	return res
+}
+
+// Cleanup forgets failures that are older than ResetAfter and not locked.
+func (g *LoginGuard) Cleanup() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	for elem := g.order.Front(); elem != nil; {
+		a := elem.Value.(*loginAttempts)
+		if now.Sub(a.lastFailure) <= g.config.ResetAfter {
+			// The rest failed even later.
+			break
+		}
+		elem = elem.Next()
+		if !a.lockedUntil.After(now) {
+			g.forget(a.key)
+		}
+	}
+}
+
+// hasRoom reports whether a new entry can be tracked. When the table is
+// full, it forgets the oldest entry if that one has expired. The caller
+// holds g.mu.
+func (g *LoginGuard) hasRoom(now time.Time) bool {
+	if len(g.attempts) < g.config.MaxTracked {
+		return true
+	}
+	front := g.order.Front()
+	if front == nil {
+		return false
+	}
+	a := front.Value.(*loginAttempts)
+	if a.lockedUntil.After(now) || now.Sub(a.lastFailure) <= g.config.ResetAfter {
+		return false
+	}
+	g.forget(a.key)
+	return true
+}
+
+// forget drops the entry and reports whether there was one. The caller
+// holds g.mu.
+func (g *LoginGuard) forget(key string) bool {
+	a, ok := g.attempts[key]
+	if !ok {
+		return false
+	}
+	g.order.Remove(a.elem)
+	delete(g.attempts, key)
+	return true
+}
+
+// StartCleanup runs Cleanup every interval until ctx is done.
+func (g *LoginGuard) StartCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.Cleanup()
+		}
+	}
+}
+
+func (g *LoginGuard) lockoutWindow(extraFailures int) time.Duration {
+	d := g.config.BaseLockout
+	for i := 0; i < extraFailures && d < g.config.MaxLockout; i++ {
+		d *= 2
+	}
+	if d > g.config.MaxLockout {
+		d = g.config.MaxLockout
+	}
+	return d
+}
+
+func (g *LoginGuard) record(ctx context.Context, event audit.Event) {
+	recordAudit(ctx, g.audit, event)
+}
+
+func lockoutKey(kind, subject string) string {
+	if kind == LockoutUsername {
+		subject = normalizeUsername(subject)
+	}
+	return kind + ":" + subject
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// clientIP returns the address of the client without the port. Behind a
+// reverse proxy it relies on middleware.RealIP having rewritten RemoteAddr.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLoginGuardKeepsCountersWhenFull(t *testing.T) {
+	ctx := context.Background()
+	guard := NewLoginGuard(LockoutConfig{
+		MaxFailures: 3,
+		BaseLockout: time.Minute,
+		MaxLockout:  time.Hour,
+		ResetAfter:  time.Hour,
+		MaxTracked:  10,
+	}, nil)
+
+	// The victim is one failure short of a lockout.
+	guard.Failure(ctx, "victim", "10.0.0.1")
+	guard.Failure(ctx, "victim", "10.0.0.1")
+
+	// Every failure tracks the username and the address.
+	for i := 0; i < 100; i++ {
+		guard.Failure(ctx, "user"+strconv.Itoa(i), "10.1.0."+strconv.Itoa(i))
+	}
+
+	guard.mu.Lock()
+	tracked := len(guard.attempts)
+	guard.mu.Unlock()
+	if tracked > 10 {
+		t.Errorf("tracks %d entries, want at most 10", tracked)
+	}
+	if guard.Check("user99", "10.0.0.1") == 0 {
+		t.Error("untracked username is not throttled while the table is full")
+	}
+
+	// The spray did not reset the victim's counter.
+	if wait := guard.Failure(ctx, "victim", "10.0.0.1"); wait == 0 {
+		t.Error("third failure of the victim did not lock it")
+	}
+}
+
+func TestLoginGuardCleanupDropsExpiredEntries(t *testing.T) {
+	guard := NewLoginGuard(LockoutConfig{MaxFailures: 5, ResetAfter: time.Millisecond, MaxTracked: 2}, nil)
+	guard.Failure(context.Background(), "alice", "10.0.0.1")
+	time.Sleep(5 * time.Millisecond)
+
+	// An expired entry makes room for a new one.
+	guard.Failure(context.Background(), "bob", "10.0.0.2")
+	guard.mu.Lock()
+	_, tracked := guard.attempts[lockoutKey(LockoutUsername, "bob")]
+	guard.mu.Unlock()
+	if !tracked {
+		t.Error("bob is not tracked although alice's entries expired")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	guard.Cleanup()
+
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+	if len(guard.attempts) != 0 || guard.order.Len() != 0 {
+		t.Errorf("tracks %d entries after cleanup", len(guard.attempts))
+	}
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type MemoryUserRepository struct {
+	mu         sync.RWMutex
+	lastID     int64
+	users      map[int64]*User
+	byUsername map[string]int64
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		users:      make(map[int64]*User),
+		byUsername: make(map[string]int64),
+	}
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := strings.ToLower(user.Username)
+	if _, ok := r.byUsername[key]; ok {
+		return ErrUserExists
+	}
+
+	now := time.Now().UTC()
+	r.lastID++
+	user.ID = r.lastID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	stored := *user
+	r.users[user.ID] = &stored
+	r.byUsername[key] = user.ID
+	return nil
+}
+
+func (r *MemoryUserRepository) GetByID(ctx context.Context, id int64) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	found := *user
+	return &found, nil
+}
+
+func (r *MemoryUserRepository) GetByUsername(ctx context.Context, username string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id, ok := r.byUsername[strings.ToLower(username)]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	found := *r.users[id]
+	return &found, nil
+}
+
+func (r *MemoryUserRepository) Update(ctx context.Context, user *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.users[user.ID]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	oldKey := strings.ToLower(current.Username)
+	newKey := strings.ToLower(user.Username)
+	if oldKey != newKey {
+		if _, taken := r.byUsername[newKey]; taken {
+			return ErrUserExists
+		}
+		delete(r.byUsername, oldKey)
+		r.byUsername[newKey] = user.ID
+	}
+
+	user.CreatedAt = current.CreatedAt
+	user.UpdatedAt = time.Now().UTC()
+	stored := *user
+	r.users[user.ID] = &stored
+	return nil
+}
+
+func (r *MemoryUserRepository) List(ctx context.Context, filter UserFilter) ([]*User, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	query := strings.ToLower(filter.Query)
+	var matched []*User
+	for _, user := range r.users {
+		if filter.TenantID != 0 && user.TenantID != filter.TenantID {
+			continue
+		}
+		if query == "" ||
+			strings.Contains(strings.ToLower(user.Username), query) ||
+			strings.Contains(strings.ToLower(user.DisplayName), query) ||
+			strings.Contains(strings.ToLower(user.Email), query) {
+			found := *user
+			matched = append(matched, &found)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+
+	total := len(matched)
+	if filter.Offset >= total {
+		return []*User{}, total, nil
+	}
+	matched = matched[filter.Offset:]
+	if len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched, total, nil
+}
+
+func (r *MemoryUserRepository) Delete(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	delete(r.byUsername, strings.ToLower(user.Username))
+	delete(r.users, id)
+	return nil
+}
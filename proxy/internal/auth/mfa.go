@@ -0,0 +1,397 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const mfaChallengeAudience = "mfa-challenge"
+
+// recoveryCodeCount is the number of recovery codes a user gets at once.
+const recoveryCodeCount = 10
+
+var (
+	ErrMFANotEnrolled       = errors.New("two-factor authentication is not enrolled")
+	ErrMFAAlreadyEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrMFACodeInvalid       = errors.New("authentication code is invalid")
+	ErrMFAChallengeInvalid  = errors.New("mfa token is invalid or expired")
+	ErrTOTPStepUsed         = errors.New("totp code was already used")
+	ErrRecoveryCodeNotFound = errors.New("recovery code not found")
+)
+
+// TOTPEnrollment holds the TOTP secret of a user. It only protects logins
+// once the user confirmed it with a code from the authenticator app.
+type TOTPEnrollment struct {
+	UserID      int64
+	Secret      string
+	ConfirmedAt *time.Time
+	// LastUsedStep is the time step of the last accepted code, so every
+	// code can be used only once.
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+// RecoveryCode is a single use code that replaces a TOTP code when the
+// authenticator is lost. Only the SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	ID        int64
+	UserID    int64
+	CodeHash  string
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type MFARepository interface {
+	// SaveTOTP stores a new unconfirmed enrollment, replacing a previous one
+	// of the user.
+	SaveTOTP(ctx context.Context, enrollment *TOTPEnrollment) error
+	GetTOTP(ctx context.Context, userID int64) (*TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userID int64, at time.Time) error
+	// UseTOTPStep atomically records the time step of an accepted code and
+	// returns ErrTOTPStepUsed unless it is newer than the last one.
+	UseTOTPStep(ctx context.Context, userID, step int64) error
+	// DeleteTOTP removes the enrollment together with the recovery codes.
+	DeleteTOTP(ctx context.Context, userID int64) error
+	// ReplaceRecoveryCodes drops every recovery code of the user and stores
+	// the given ones.
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes []string) error
+	// UseRecoveryCode atomically marks an unused code as used and returns
+	// ErrRecoveryCodeNotFound if there is none.
+	UseRecoveryCode(ctx context.Context, userID int64, hash string, at time.Time) error
+	CountRecoveryCodes(ctx context.Context, userID int64) (int, error)
+}
+
+type MemoryMFARepository struct {
+	mu            sync.Mutex
+	lastID        int64
+	enrollments   map[int64]*TOTPEnrollment
+	recoveryCodes map[int64][]*RecoveryCode
+}
+
+func NewMemoryMFARepository() *MemoryMFARepository {
+	return &MemoryMFARepository{
+		enrollments:   make(map[int64]*TOTPEnrollment),
+		recoveryCodes: make(map[int64][]*RecoveryCode),
+	}
+}
+
+func (r *MemoryMFARepository) SaveTOTP(ctx context.Context, enrollment *TOTPEnrollment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enrollment.CreatedAt = time.Now().UTC()
+	stored := *enrollment
+	r.enrollments[enrollment.UserID] = &stored
+	return nil
+}
+
+func (r *MemoryMFARepository) GetTOTP(ctx context.Context, userID int64) (*TOTPEnrollment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enrollment, ok := r.enrollments[userID]
+	if !ok {
+		return nil, ErrMFANotEnrolled
+	}
+	found := *enrollment
+	return &found, nil
+}
+
+func (r *MemoryMFARepository) ConfirmTOTP(ctx context.Context, userID int64, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enrollment, ok := r.enrollments[userID]
+	if !ok {
+		return ErrMFANotEnrolled
+	}
+	enrollment.ConfirmedAt = &at
+	return nil
+}
+
+func (r *MemoryMFARepository) UseTOTPStep(ctx context.Context, userID, step int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enrollment, ok := r.enrollments[userID]
+	if !ok {
+		return ErrMFANotEnrolled
+	}
+	if step <= enrollment.LastUsedStep {
+		return ErrTOTPStepUsed
+	}
+	enrollment.LastUsedStep = step
+	return nil
+}
+
+func (r *MemoryMFARepository) DeleteTOTP(ctx context.Context, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.enrollments, userID)
+	delete(r.recoveryCodes, userID)
+	return nil
+}
+
+func (r *MemoryMFARepository) ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	codes := make([]*RecoveryCode, 0, len(hashes))
+	for _, hash := range hashes {
+		r.lastID++
+		codes = append(codes, &RecoveryCode{ID: r.lastID, UserID: userID, CodeHash: hash, CreatedAt: now})
+	}
+	r.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (r *MemoryMFARepository) UseRecoveryCode(ctx context.Context, userID int64, hash string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, code := range r.recoveryCodes[userID] {
+		if code.CodeHash == hash && code.UsedAt == nil {
+			code.UsedAt = &at
+			return nil
+		}
+	}
+	return ErrRecoveryCodeNotFound
+}
+
+func (r *MemoryMFARepository) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, code := range r.recoveryCodes[userID] {
+		if code.UsedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type MFAConfig struct {
+	// Issuer is the name authenticator apps show next to the account.
+	Issuer string
+	// TokenIssuer and ChallengeTTL describe the challenge token that links
+	// the two steps of a login.
+	TokenIssuer  string
+	ChallengeTTL time.Duration
+}
+
+// TOTPSetup is what a user needs to add the account to an authenticator app.
+type TOTPSetup struct {
+	Secret string
+	URI    string
+	// QRCode is a PNG image of URI.
+	QRCode []byte
+}
+
+// MFAService manages TOTP second factors and the challenge tokens of the
+// two-step login.
+type MFAService struct {
+	repo   MFARepository
+	codec  TokenCodec
+	config MFAConfig
+}
+
+func NewMFAService(repo MFARepository, codec TokenCodec, config MFAConfig) *MFAService {
+	return &MFAService{
+		repo:   repo,
+		codec:  codec,
+		config: config,
+	}
+}
+
+// Enabled reports whether logins of the user need a second factor.
+func (s *MFAService) Enabled(ctx context.Context, userID int64) (bool, error) {
+	enrollment, err := s.repo.GetTOTP(ctx, userID)
+	if errors.Is(err, ErrMFANotEnrolled) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return enrollment.ConfirmedAt != nil, nil
+}
+
+// RecoveryCodesLeft returns the number of unused recovery codes.
+func (s *MFAService) RecoveryCodesLeft(ctx context.Context, userID int64) (int, error) {
+	return s.repo.CountRecoveryCodes(ctx, userID)
+}
+
+// Enroll generates a new TOTP secret for the user. It replaces a previous
+// enrollment that was never confirmed.
+func (s *MFAService) Enroll(ctx context.Context, user *User) (*TOTPSetup, error) {
+	enabled, err := s.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveTOTP(ctx, &TOTPEnrollment{UserID: user.ID, Secret: secret}); err != nil {
+		return nil, err
+	}
+
+	uri := totpURI(s.config.Issuer, user.Username, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return nil, err
+	}
+	return &TOTPSetup{Secret: secret, URI: uri, QRCode: png}, nil
+}
+
+// Confirm enables the pending enrollment once the user proved it works with a
+// code and returns the recovery codes, which are not shown again.
+func (s *MFAService) Confirm(ctx context.Context, userID int64, code string) ([]string, error) {
+	enrollment, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enrollment.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if err := s.useTOTP(ctx, enrollment, code); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.newRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ConfirmTOTP(ctx, userID, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable removes the second factor after checking a TOTP or recovery code.
+func (s *MFAService) Disable(ctx context.Context, userID int64, code string) error {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+	return s.repo.DeleteTOTP(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the user after
+// checking a TOTP or recovery code.
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) ([]string, error) {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+	return s.newRecoveryCodes(ctx, userID)
+}
+
+// Verify checks a TOTP code or, if it does not look like one, a recovery
+// code. Both can be used only once.
+func (s *MFAService) Verify(ctx context.Context, userID int64, code string) error {
+	enrollment, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if enrollment.ConfirmedAt == nil {
+		return ErrMFANotEnrolled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		return s.useTOTP(ctx, enrollment, code)
+	}
+
+	err = s.repo.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)), time.Now().UTC())
+	if errors.Is(err, ErrRecoveryCodeNotFound) {
+		return ErrMFACodeInvalid
+	}
+	return err
+}
+
+func (s *MFAService) useTOTP(ctx context.Context, enrollment *TOTPEnrollment, code string) error {
+	step, ok := matchTOTP(enrollment.Secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return ErrMFACodeInvalid
+	}
+	err := s.repo.UseTOTPStep(ctx, enrollment.UserID, step)
+	if errors.Is(err, ErrTOTPStepUsed) {
+		return ErrMFACodeInvalid
+	}
+	return err
+}
+
+func (s *MFAService) newRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(b))
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashToken(raw)
+	}
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode accepts recovery codes typed in any case and with or
+// without the separator.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// Challenge returns a short-lived token that proves the user passed the first
+// step of the login.
+func (s *MFAService) Challenge(user *User) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	return encodeWithAudience(s.codec, mfaChallengeAudience, TokenClaims{
+		"sub": strconv.FormatInt(user.ID, 10),
+		"iss": s.config.TokenIssuer,
+		"jti": jti,
+		"iat": now.Unix(),
+		"exp": now.Add(s.config.ChallengeTTL).Unix(),
+	})
+}
+
+// ParseChallenge returns the ID of the user a challenge token was issued to.
+func (s *MFAService) ParseChallenge(raw string) (int64, error) {
+	token, err := decodeWithAudience(s.codec, raw, s.config.TokenIssuer, mfaChallengeAudience)
+	if err != nil {
+		return 0, ErrMFAChallengeInvalid
+	}
+
+	userID, err := strconv.ParseInt(token.Subject(), 10, 64)
+	if err != nil {
+		return 0, ErrMFAChallengeInvalid
+	}
+	return userID, nil
+}
+
+// ChallengeTTL is how long the second step of a login can be completed in.
+func (s *MFAService) ChallengeTTL() time.Duration {
+	return s.config.ChallengeTTL
+}
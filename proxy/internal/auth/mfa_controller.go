@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"test/internal/responder"
+)
+
+type MFAController struct {
+	mfa   *MFAService
+	users UserRepository
+	guard *LoginGuard
+}
+
+func NewMFAController(mfa *MFAService, users UserRepository, guard *LoginGuard) *MFAController {
+	return &MFAController{
+		mfa:   mfa,
+		users: users,
+		guard: guard,
+	}
+}
+
+// Status godoc
+// @Summary Состояние двухфакторной аутентификации
+// @Description Показывает, включена ли двухфакторная аутентификация, и сколько осталось неиспользованных кодов восстановления
+// @Tags mfa
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} MFAStatusResponse "Состояние"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /me/mfa [get]
+func (c *MFAController) Status() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := ClaimsFromContext(r.Context())
+		enabled, err := c.mfa.Enabled(r.Context(), claims.UserID())
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		left := 0
+		if enabled {
+			left, err = c.mfa.RecoveryCodesLeft(r.Context(), claims.UserID())
+			if err != nil {
+				responder.ErrorInternal(w, err)
+				return
+			}
+		}
+
+		responder.OutputJSON(w, MFAStatusResponse{Enabled: enabled, RecoveryCodesLeft: left})
+	}
+}
+
+// Enroll godoc
+// @Summary Подключение TOTP
+// @Description Создает новый секрет TOTP и возвращает его вместе с otpauth URI и QR кодом (PNG в base64) для приложения-аутентификатора. Вход начнет требовать код только после подтверждения через /me/mfa/totp/verify
+// @Tags mfa
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} TOTPEnrollResponse "Секрет для приложения-аутентификатора"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 409 {object} ErrorResponse "Двухфакторная аутентификация уже включена"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /me/mfa/totp [post]
+func (c *MFAController) Enroll() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r, c.users)
+		if !ok {
+			return
+		}
+
+		setup, err := c.mfa.Enroll(r.Context(), user)
+		if errors.Is(err, ErrMFAAlreadyEnabled) {
+			responder.ErrorConflict(w, err)
+			return
+		}
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		responder.OutputJSON(w, TOTPEnrollResponse{
+			Secret:     setup.Secret,
+			OTPAuthURI: setup.URI,
+			QRCode:     setup.QRCode,
+		})
+	}
+}
+
+// Verify godoc
+// @Summary Подтверждение TOTP
+// @Description Включает двухфакторную аутентификацию, если код из приложения-аутентификатора верен, и возвращает одноразовые коды восстановления. Коды показываются только один раз
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MFACodeRequest true "Код из приложения-аутентификатора"
+// @Success 200 {object} RecoveryCodesResponse "Двухфакторная аутентификация включена"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос, неверный код или TOTP не подключен"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 409 {object} ErrorResponse "Двухфакторная аутентификация уже включена"
+// @Failure 429 {object} ErrorResponse "Слишком много неверных кодов, время ожидания в заголовке Retry-After"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /me/mfa/totp/verify [post]
+func (c *MFAController) Verify() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data MFACodeRequest
+		user, ok := c.decodeCodeRequest(w, r, &data)
+		if !ok {
+			return
+		}
+
+		codes, err := c.mfa.Confirm(r.Context(), user.ID, data.Code)
+		if !c.checkCode(w, r, user, err) {
+			return
+		}
+
+		responder.OutputJSON(w, RecoveryCodesResponse{RecoveryCodes: codes})
+	}
+}
+
+// Disable godoc
+// @Summary Отключение двухфакторной аутентификации
+// @Description Отключает TOTP и удаляет коды восстановления. Требует текущий код из приложения или код восстановления
+// @Tags mfa
+// @Accept json
+// @Security BearerAuth
+// @Param request body MFACodeRequest true "Код TOTP или код восстановления"
+// @Success 204 "Двухфакторная аутентификация отключена"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос, неверный код или TOTP не подключен"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 429 {object} ErrorResponse "Слишком много неверных кодов, время ожидания в заголовке Retry-After"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /me/mfa/totp/disable [post]
+func (c *MFAController) Disable() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data MFACodeRequest
+		user, ok := c.decodeCodeRequest(w, r, &data)
+		if !ok {
+			return
+		}
+
+		err := c.mfa.Disable(r.Context(), user.ID, data.Code)
+		if !c.checkCode(w, r, user, err) {
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RecoveryCodes godoc
+// @Summary Новые коды восстановления
+// @Description Заменяет все коды восстановления новыми. Требует текущий код из приложения или код восстановления
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MFACodeRequest true "Код TOTP или код восстановления"
+// @Success 200 {object} RecoveryCodesResponse "Новые коды восстановления"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос, неверный код или TOTP не подключен"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 429 {object} ErrorResponse "Слишком много неверных кодов, время ожидания в заголовке Retry-After"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /me/mfa/recovery-codes [post]
+func (c *MFAController) RecoveryCodes() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data MFACodeRequest
+		user, ok := c.decodeCodeRequest(w, r, &data)
+		if !ok {
+			return
+		}
+
+		codes, err := c.mfa.RegenerateRecoveryCodes(r.Context(), user.ID, data.Code)
+		if !c.checkCode(w, r, user, err) {
+			return
+		}
+
+		responder.OutputJSON(w, RecoveryCodesResponse{RecoveryCodes: codes})
+	}
+}
+
+func (c *MFAController) decodeCodeRequest(w http.ResponseWriter, r *http.Request, data *MFACodeRequest) (*User, bool) {
+	if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+		responder.ErrorBadRequest(w, err)
+		return nil, false
+	}
+	if data.Code == "" {
+		responder.ErrorBadRequest(w, errors.New("code is required"))
+		return nil, false
+	}
+
+	user, ok := currentUser(w, r, c.users)
+	if !ok {
+		return nil, false
+	}
+	// Codes can be guessed here as well, so failures count towards the
+	// login lockout.
+	if wait := c.guard.Check(user.Username, clientIP(r)); wait > 0 {
+		responder.ErrorTooManyRequests(w, ErrLoginLocked, wait)
+		return nil, false
+	}
+	return user, true
+}
+
+// checkCode responds with an error unless the code was accepted.
+func (c *MFAController) checkCode(w http.ResponseWriter, r *http.Request, user *User, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrMFACodeInvalid):
+		if wait := c.guard.Failure(r.Context(), user.Username, clientIP(r)); wait > 0 {
+			responder.ErrorTooManyRequests(w, ErrLoginLocked, wait)
+			return false
+		}
+		responder.ErrorBadRequest(w, err)
+	case errors.Is(err, ErrMFANotEnrolled):
+		responder.ErrorBadRequest(w, err)
+	case errors.Is(err, ErrMFAAlreadyEnabled):
+		responder.ErrorConflict(w, err)
+	default:
+		responder.ErrorInternal(w, err)
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"test/internal/database"
+)
+
+var mfaMigrations = []string{
+	`CREATE TABLE totp_enrollments (
+		user_id        INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		secret         TEXT NOT NULL,
+		confirmed_at   TIMESTAMP,
+		last_used_step INTEGER NOT NULL DEFAULT 0,
+		created_at     TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE recovery_codes (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		code_hash  TEXT NOT NULL,
+		used_at    TIMESTAMP,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX recovery_codes_user_id ON recovery_codes (user_id)`,
+}
+
+type SQLiteMFARepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteMFARepository must be created after the user repository because
+// its tables reference the users table.
+func NewSQLiteMFARepository(db *sql.DB) (*SQLiteMFARepository, error) {
+	if err := database.Migrate(db, "mfa", mfaMigrations); err != nil {
+		return nil, err
+	}
+	return &SQLiteMFARepository{db: db}, nil
+}
+
+func (r *SQLiteMFARepository) SaveTOTP(ctx context.Context, enrollment *TOTPEnrollment) error {
+	enrollment.CreatedAt = time.Now().UTC()
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO totp_enrollments (user_id, secret, confirmed_at, last_used_step, created_at) VALUES (?, ?, NULL, 0, ?)
+		ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, confirmed_at = NULL, last_used_step = 0, created_at = excluded.created_at`,
+		enrollment.UserID, enrollment.Secret, enrollment.CreatedAt,
+	)
+	return err
+}
+
+func (r *SQLiteMFARepository) GetTOTP(ctx context.Context, userID int64) (*TOTPEnrollment, error) {
+	enrollment := TOTPEnrollment{UserID: userID}
+	var confirmedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		`SELECT secret, confirmed_at, last_used_step, created_at FROM totp_enrollments WHERE user_id = ?`, userID,
+	).Scan(&enrollment.Secret, &confirmedAt, &enrollment.LastUsedStep, &enrollment.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if confirmedAt.Valid {
+		enrollment.ConfirmedAt = &confirmedAt.Time
+	}
+	return &enrollment, nil
+}
+
+func (r *SQLiteMFARepository) ConfirmTOTP(ctx context.Context, userID int64, at time.Time) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE totp_enrollments SET confirmed_at = ? WHERE user_id = ?`, at.UTC(), userID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrMFANotEnrolled
+	}
+	return nil
+}
+
+func (r *SQLiteMFARepository) UseTOTPStep(ctx context.Context, userID, step int64) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE totp_enrollments SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?`, step, userID, step,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTOTPStepUsed
+	}
+	return nil
+}
+
+func (r *SQLiteMFARepository) DeleteTOTP(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM totp_enrollments WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteMFARepository) ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, hash := range hashes {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)`, userID, hash, now,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteMFARepository) UseRecoveryCode(ctx context.Context, userID int64, hash string, at time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE recovery_codes SET used_at = ?
+		WHERE id = (SELECT id FROM recovery_codes WHERE user_id = ? AND code_hash = ? AND used_at IS NULL LIMIT 1)`,
+		at.UTC(), userID, hash,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrRecoveryCodeNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteMFARepository) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID,
+	).Scan(&count)
+	return count, err
+}
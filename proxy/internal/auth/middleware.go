@@ -0,0 +1,361 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"test/internal/audit"
+	"test/internal/responder"
+	"test/internal/tenant"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+var (
+	ErrTokenMissing          = errors.New("authorization token is missing")
+	ErrTokenMalformed        = errors.New("token is malformed")
+	ErrTokenSignatureInvalid = errors.New("token signature is invalid")
+	ErrTokenExpired          = errors.New("token has expired")
+	ErrTokenNotYetValid      = errors.New("token is not valid yet")
+	ErrTokenIssuedInFuture   = errors.New("token is issued in the future")
+	ErrTokenIssuerInvalid    = errors.New("token issuer is not accepted")
+	ErrTokenAudienceInvalid  = errors.New("token audience is not accepted")
+	ErrTokenClaimMissing     = errors.New("token is missing a required claim")
+	ErrTokenRevoked          = errors.New("token has been revoked")
+)
+
+// Verifier works like jwtauth.Verify but keeps the precise reason a token
+// was rejected, so Authenticator can tell clients an expired token apart from
+// a forged or malformed one. The token is looked up with findTokenFns in
+// order and only in the Authorization header when none are given.
+func Verifier(ja TokenCodec, findTokenFns ...func(r *http.Request) string) func(http.Handler) http.Handler {
+	if len(findTokenFns) == 0 {
+		findTokenFns = []func(r *http.Request) string{jwtauth.TokenFromHeader}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := verifyRequest(ja, r, findTokenFns)
+			ctx := jwtauth.NewContext(r.Context(), token, err)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func verifyRequest(ja TokenCodec, r *http.Request, findTokenFns []func(r *http.Request) string) (jwt.Token, error) {
+	var tokenString string
+	for _, fn := range findTokenFns {
+		if tokenString = fn(r); tokenString != "" {
+			break
+		}
+	}
+	if tokenString == "" {
+		return nil, ErrTokenMissing
+	}
+	return verifyToken(ja, tokenString)
+}
+
+// verifyToken checks the signature and the claims of an access token.
+func verifyToken(ja TokenCodec, tokenString string) (jwt.Token, error) {
+	token, err := ja.Decode(tokenString)
+	if err != nil {
+		if _, perr := jwt.ParseInsecure([]byte(tokenString)); perr == nil {
+			return nil, ErrTokenSignatureInvalid
+		}
+		return nil, ErrTokenMalformed
+	}
+
+	if err := jwt.Validate(token, ja.ValidateOptions()...); err != nil {
+		return token, validationReason(err)
+	}
+	return token, nil
+}
+
+func validationReason(err error) error {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired()):
+		return ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotYetValid()):
+		return ErrTokenNotYetValid
+	case errors.Is(err, jwt.ErrInvalidIssuedAt()):
+		return ErrTokenIssuedInFuture
+	case errors.Is(err, jwt.ErrInvalidIssuer()):
+		return ErrTokenIssuerInvalid
+	case errors.Is(err, jwt.ErrInvalidAudience()):
+		return ErrTokenAudienceInvalid
+	case errors.Is(err, jwt.ErrRequiredClaim()):
+		return ErrTokenClaimMissing
+	default:
+		return ErrTokenMalformed
+	}
+}
+
+// CheckRevoked marks tokens that passed Verifier but are on the denylist as
+// revoked. It must be placed between Verifier and Authenticator.
+func CheckRevoked(denylist *Denylist) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, _, err := jwtauth.FromContext(r.Context())
+			if err != nil || token == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			userID, _ := strconv.ParseInt(token.Subject(), 10, 64)
+			if denylist.IsRevoked(token.JwtID(), userID, tokenIssuedAt(token)) {
+				ctx := jwtauth.NewContext(r.Context(), token, ErrTokenRevoked)
+				r = r.WithContext(ctx)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// APIKeyVerifier authenticates requests that carry an API key in the
+// X-API-Key header or as "Authorization: ApiKey <key>". Requests without a
+// key are passed on unchanged, so it can be combined with Verifier and
+// Authenticator to accept either credential. It must be placed before them.
+func APIKeyVerifier(keys *APIKeyService) func(http.Handler) http.Handler {
+	return credentialVerifier(apiKeyFromRequest, keys.Authenticate, ErrInvalidAPIKey,
+		`ApiKey error="invalid_key"`)
+}
+
+// PersonalTokenVerifier authenticates requests that carry a personal access
+// token as "Authorization: Bearer hpat_...". Other requests are passed on
+// unchanged. It must be placed before Verifier and Authenticator.
+func PersonalTokenVerifier(tokens *PersonalTokenService) func(http.Handler) http.Handler {
+	fromHeader := func(r *http.Request) string {
+		if raw := jwtauth.TokenFromHeader(r); isPersonalToken(raw) {
+			return raw
+		}
+		return ""
+	}
+	return credentialVerifier(fromHeader, tokens.Authenticate, ErrInvalidPersonalToken,
+		`Bearer error="invalid_token", error_description="`+ErrInvalidPersonalToken.Error()+`"`)
+}
+
+// credentialVerifier authenticates requests for which extract finds a
+// credential and stores the claims of its owner in the context. A credential
+// that authenticate rejects with invalid is answered with 401 and the
+// challenge in WWW-Authenticate.
+func credentialVerifier(extract func(r *http.Request) string, authenticate func(ctx context.Context, raw string) (*Claims, error), invalid error, challenge string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw := extract(r)
+			if raw == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, err := authenticate(r.Context(), raw)
+			if errors.Is(err, invalid) {
+				w.Header().Set("WWW-Authenticate", challenge)
+				responder.ErrorUnauthorized(w, err)
+				return
+			}
+			if err != nil {
+				responder.ErrorInternal(w, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// RequireScope lets requests made with a personal access token through only
+// if the token has the scope. Routes guarded by RequirePermission already
+// check the scopes, RequireScope is meant for routes any user may call. It
+// must be placed after Authenticator.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := ClaimsFromContext(r.Context())
+			if claims.PersonalTokenID != 0 && !claims.HasPermission(scope) {
+				responder.ErrorForbidden(w, fmt.Errorf("scope %s required", scope))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RejectPersonalTokens rejects requests made with a personal access token
+// with 403, e.g. on routes that manage the account or the tokens themselves.
+// It must be placed after Authenticator.
+func RejectPersonalTokens(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := ClaimsFromContext(r.Context())
+		if claims.PersonalTokenID != 0 {
+			responder.ErrorForbidden(w, ErrPersonalTokenDenied)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return strings.TrimSpace(key)
+	}
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "ApiKey ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return ""
+}
+
+// RequirePermission only lets through requests whose token grants the
+// permission. It must be placed after Authenticator.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := ClaimsFromContext(r.Context())
+			if !claims.HasPermission(permission) {
+				responder.ErrorForbidden(w, fmt.Errorf("permission %s required", permission))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireVerifiedEmail rejects users whose email address is not verified with
+// 403. It must be placed after Authenticator.
+func RequireVerifiedEmail(users UserRepository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := ClaimsFromContext(r.Context())
+			user, err := users.GetByID(r.Context(), claims.UserID())
+			if errors.Is(err, ErrUserNotFound) {
+				responder.ErrorUnauthorized(w, err)
+				return
+			}
+			if err != nil {
+				responder.ErrorInternal(w, err)
+				return
+			}
+			if user.EmailVerifiedAt == nil {
+				responder.ErrorForbidden(w, ErrEmailNotVerified)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RejectDisabled rejects users whose account was disabled by an admin with
+// 403. Tokens are revoked when an account is disabled, so this mainly covers
+// API keys and tokens issued while the account was being disabled. It must
+// be placed after Authenticator.
+func RejectDisabled(users UserRepository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := ClaimsFromContext(r.Context())
+			user, err := users.GetByID(r.Context(), claims.UserID())
+			if errors.Is(err, ErrUserNotFound) {
+				responder.ErrorUnauthorized(w, err)
+				return
+			}
+			if err != nil {
+				responder.ErrorInternal(w, err)
+				return
+			}
+			if user.DisabledAt != nil {
+				responder.ErrorForbidden(w, ErrUserDisabled)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TenantLimits enforces the rate limit and daily quota of the tenant the user
+// belongs to and stores the tenant in the request context. Requests over a
+// limit are rejected with 429. Users without a tenant are not limited. It
+// must be placed after Authenticator.
+func TenantLimits(tenants tenant.Repository, limiter *tenant.Limiter, auditLog audit.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := ClaimsFromContext(r.Context())
+			if claims.TenantID == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			t, err := tenants.Get(r.Context(), claims.TenantID)
+			if errors.Is(err, tenant.ErrTenantNotFound) {
+				responder.ErrorForbidden(w, err)
+				return
+			}
+			if err != nil {
+				responder.ErrorInternal(w, err)
+				return
+			}
+
+			wait, first, err := limiter.Allow(t, time.Now())
+			switch {
+			case errors.Is(err, tenant.ErrRateLimited):
+				tenant.Count(t, tenant.MetricRateLimited)
+				responder.ErrorTooManyRequests(w, err, wait)
+				return
+			case errors.Is(err, tenant.ErrQuotaExceeded):
+				tenant.Count(t, tenant.MetricQuotaExceeded)
+				// Only the first rejection of a day is recorded, so a client
+				// retrying in a loop does not flood the log.
+				if first {
+					recordAudit(r.Context(), auditLog, audit.Event{
+						Type:     audit.EventTenantQuota,
+						UserID:   claims.UserID(),
+						Username: claims.Username,
+						TenantID: t.ID,
+						Details:  map[string]string{"quota": strconv.Itoa(t.DailyQuota)},
+					})
+				}
+				responder.ErrorTooManyRequests(w, err, wait)
+				return
+			}
+			tenant.Count(t, tenant.MetricRequests)
+
+			next.ServeHTTP(w, r.WithContext(tenant.NewContext(r.Context(), t)))
+		})
+	}
+}
+
+// Authenticator rejects requests whose token did not pass Verifier with 401
+// and the reason of the failure. Requests already authenticated by
+// APIKeyVerifier or PersonalTokenVerifier are let through.
+func Authenticator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(claimsContextKey{}).(*Claims); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, _, err := jwtauth.FromContext(r.Context())
+		if err == nil && token == nil {
+			err = ErrTokenMissing
+		}
+		if err != nil {
+			if errors.Is(err, ErrTokenMissing) {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="`+err.Error()+`"`)
+			}
+			responder.ErrorUnauthorized(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,363 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"golang.org/x/oauth2"
+)
+
+const oidcStateAudience = "oidc-state"
+
+// oidcHTTPTimeout bounds the requests to the identity provider unless
+// OIDCConfig.HTTPClient is set.
+const oidcHTTPTimeout = 10 * time.Second
+
+var (
+	ErrOIDCIdentityNotFound = errors.New("oidc identity not found")
+	ErrOIDCStateInvalid     = errors.New("oidc login state is invalid or expired")
+	ErrOIDCTokenInvalid     = errors.New("id token from the identity provider is invalid")
+	ErrOIDCCodeRejected     = errors.New("authorization code was rejected by the identity provider")
+)
+
+// OIDCIdentity links the subject of an external identity provider to a local
+// user.
+type OIDCIdentity struct {
+	Issuer    string
+	Subject   string
+	UserID    int64
+	CreatedAt time.Time
+}
+
+type OIDCIdentityRepository interface {
+	// Link stores the identity, replacing a previous link of the same issuer
+	// and subject.
+	Link(ctx context.Context, identity *OIDCIdentity) error
+	Get(ctx context.Context, issuer, subject string) (*OIDCIdentity, error)
+}
+
+type MemoryOIDCIdentityRepository struct {
+	mu         sync.Mutex
+	identities map[string]*OIDCIdentity
+}
+
+func NewMemoryOIDCIdentityRepository() *MemoryOIDCIdentityRepository {
+	return &MemoryOIDCIdentityRepository{
+		identities: make(map[string]*OIDCIdentity),
+	}
+}
+
+func (r *MemoryOIDCIdentityRepository) Link(ctx context.Context, identity *OIDCIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	identity.CreatedAt = time.Now().UTC()
+	stored := *identity
+	r.identities[identity.Issuer+"\x00"+identity.Subject] = &stored
+	return nil
+}
+
+func (r *MemoryOIDCIdentityRepository) Get(ctx context.Context, issuer, subject string) (*OIDCIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	identity, ok := r.identities[issuer+"\x00"+subject]
+	if !ok {
+		return nil, ErrOIDCIdentityNotFound
+	}
+	found := *identity
+	return &found, nil
+}
+
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// UsernameClaim, EmailClaim and NameClaim name the ID token claims a new
+	// local user is provisioned from.
+	UsernameClaim string
+	EmailClaim    string
+	NameClaim     string
+	// StateIssuer signs the short-lived state kept in a cookie between the
+	// redirect to the provider and the callback.
+	StateIssuer string
+	StateTTL    time.Duration
+	ClockSkew   time.Duration
+	// HTTPClient is used for discovery, the signing keys and the code
+	// exchange. A client with a timeout is used if it is nil.
+	HTTPClient *http.Client
+}
+
+// oidcLoginState is what the service needs to remember between the redirect
+// to the identity provider and the callback.
+type oidcLoginState struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// OIDCService signs users in with an external OpenID Connect provider using
+// the authorization code flow with PKCE. Users that sign in for the first
+// time get a local account without a password.
+type OIDCService struct {
+	identities OIDCIdentityRepository
+	users      UserRepository
+	roles      *RoleService
+	codec      TokenCodec
+	oauth      *oauth2.Config
+	keys       jwk.Set
+	http       *http.Client
+	config     OIDCConfig
+}
+
+type oidcProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDCService reads the discovery document of the provider and fetches its
+// signing keys, which are refreshed in the background afterwards.
+func NewOIDCService(ctx context.Context, identities OIDCIdentityRepository, users UserRepository, roles *RoleService, codec TokenCodec, config OIDCConfig) (*OIDCService, error) {
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: oidcHTTPTimeout}
+	}
+	metadata, err := discoverOIDCProvider(ctx, client, config.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := jwk.NewCache(ctx)
+	if err := cache.Register(metadata.JWKSURI, jwk.WithMinRefreshInterval(15*time.Minute), jwk.WithHTTPClient(client)); err != nil {
+		return nil, err
+	}
+	if _, err := cache.Refresh(ctx, metadata.JWKSURI); err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", metadata.JWKSURI, err)
+	}
+
+	return &OIDCService{
+		identities: identities,
+		users:      users,
+		roles:      roles,
+		codec:      codec,
+		oauth: &oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Scopes:       config.Scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  metadata.AuthorizationEndpoint,
+				TokenURL: metadata.TokenEndpoint,
+			},
+		},
+		keys:   jwk.NewCachedSet(cache, metadata.JWKSURI),
+		http:   client,
+		config: config,
+	}, nil
+}
+
+func discoverOIDCProvider(ctx context.Context, client *http.Client, issuer string) (*oidcProviderMetadata, error) {
+	wellKnown := strings.TrimRight(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: unexpected status %s", wellKnown, resp.Status)
+	}
+
+	var metadata oidcProviderMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", wellKnown, err)
+	}
+	if metadata.Issuer != issuer {
+		return nil, fmt.Errorf("provider reports issuer %q, expected %q", metadata.Issuer, issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("%s lacks a required endpoint", wellKnown)
+	}
+	return &metadata, nil
+}
+
+// Start returns the URL of the provider's login page together with the signed
+// state the callback has to be called with.
+func (s *OIDCService) Start() (authURL, signedState string, err error) {
+	state, err := randomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	now := time.Now().UTC()
+	signedState, err = encodeWithAudience(s.codec, oidcStateAudience, TokenClaims{
+		"iss":      s.config.StateIssuer,
+		"iat":      now.Unix(),
+		"exp":      now.Add(s.config.StateTTL).Unix(),
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL = s.oauth.AuthCodeURL(state,
+		oauth2.S256ChallengeOption(verifier),
+		oauth2.SetAuthURLParam("nonce", nonce),
+	)
+	return authURL, signedState, nil
+}
+
+// Finish exchanges the authorization code for an ID token and returns the
+// local user it belongs to, provisioning one on the first login.
+func (s *OIDCService) Finish(ctx context.Context, signedState, state, code string) (*User, error) {
+	login, err := s.decodeState(signedState)
+	if err != nil || login.State != state {
+		return nil, ErrOIDCStateInvalid
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, s.http)
+	token, err := s.oauth.Exchange(ctx, code, oauth2.VerifierOption(login.Verifier))
+	var rejected *oauth2.RetrieveError
+	if errors.As(err, &rejected) {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCCodeRejected, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("exchange authorization code: %w", err)
+	}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, ErrOIDCTokenInvalid
+	}
+
+	idToken, err := jwt.ParseString(rawIDToken,
+		jwt.WithKeySet(s.keys, jws.WithInferAlgorithmFromKey(true)),
+		jwt.WithValidate(true),
+		jwt.WithIssuer(s.config.Issuer),
+		jwt.WithAudience(s.config.ClientID),
+		jwt.WithAcceptableSkew(s.config.ClockSkew),
+		jwt.WithRequiredClaim("sub"),
+		jwt.WithClaimValue("nonce", login.Nonce),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCTokenInvalid, err)
+	}
+
+	return s.userFor(ctx, idToken)
+}
+
+func (s *OIDCService) decodeState(signedState string) (*oidcLoginState, error) {
+	token, err := decodeWithAudience(s.codec, signedState, s.config.StateIssuer, oidcStateAudience)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.PrivateClaims()
+	state, _ := claims["state"].(string)
+	nonce, _ := claims["nonce"].(string)
+	verifier, _ := claims["verifier"].(string)
+	if state == "" || nonce == "" || verifier == "" {
+		return nil, ErrOIDCStateInvalid
+	}
+	return &oidcLoginState{State: state, Nonce: nonce, Verifier: verifier}, nil
+}
+
+func (s *OIDCService) userFor(ctx context.Context, idToken jwt.Token) (*User, error) {
+	identity, err := s.identities.Get(ctx, s.config.Issuer, idToken.Subject())
+	if err == nil {
+		user, err := s.users.GetByID(ctx, identity.UserID)
+		if !errors.Is(err, ErrUserNotFound) {
+			return user, err
+		}
+		// The local user was deleted, so the identity is provisioned again.
+	} else if !errors.Is(err, ErrOIDCIdentityNotFound) {
+		return nil, err
+	}
+
+	user, err := s.provision(ctx, idToken)
+	if err != nil {
+		return nil, err
+	}
+	err = s.identities.Link(ctx, &OIDCIdentity{
+		Issuer:  s.config.Issuer,
+		Subject: idToken.Subject(),
+		UserID:  user.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// provision creates a local user from the mapped claims. A username that is
+// invalid or already taken by a local account is replaced by one derived from
+// the subject, so an external identity never takes over an existing account.
+func (s *OIDCService) provision(ctx context.Context, idToken jwt.Token) (*User, error) {
+	claims, err := idToken.AsMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claim := func(name string) string {
+		value, _ := claims[name].(string)
+		return strings.TrimSpace(value)
+	}
+
+	user := &User{}
+	if email := claim(s.config.EmailClaim); email != "" && ValidateEmail(email) == "" {
+		user.Email = email
+		if verified, _ := claims["email_verified"].(bool); verified {
+			now := time.Now().UTC()
+			user.EmailVerifiedAt = &now
+		}
+	}
+	if name := claim(s.config.NameClaim); ValidateDisplayName(name) == "" {
+		user.DisplayName = name
+	}
+
+	sum := sha256.Sum256([]byte(s.config.Issuer + "\x00" + idToken.Subject()))
+	fallback := "oidc-" + hex.EncodeToString(sum[:])[:12]
+	candidates := []string{fallback}
+	if username := claim(s.config.UsernameClaim); username != "" && ValidateUsername(username) == "" {
+		candidates = []string{username, fallback}
+	}
+
+	for _, username := range candidates {
+		user.Username = username
+		err = s.users.Create(ctx, user)
+		if errors.Is(err, ErrUserExists) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.roles.AssignDefaults(ctx, user); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	return nil, fmt.Errorf("provision user for subject %s: %w", idToken.Subject(), err)
+}
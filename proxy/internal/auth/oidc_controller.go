@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"test/internal/audit"
+	"test/internal/responder"
+)
+
+const oidcStateCookie = "oidc_state"
+
+type OIDCController struct {
+	oidc   *OIDCService
+	tokens *TokenService
+	// secureCookies is set when the service is reachable over HTTPS only.
+	secureCookies bool
+	// sessions is nil unless browser sessions in cookies are enabled.
+	sessions *Sessions
+	audit    audit.Logger
+}
+
+func NewOIDCController(oidc *OIDCService, tokens *TokenService, secureCookies bool, sessions *Sessions, auditLog audit.Logger) *OIDCController {
+	return &OIDCController{
+		oidc:          oidc,
+		tokens:        tokens,
+		secureCookies: secureCookies,
+		sessions:      sessions,
+		audit:         auditLog,
+	}
+}
+
+// Login godoc
+// @Summary Вход через OpenID Connect
+// @Description Перенаправляет на страницу входа внешнего провайдера (authorization code + PKCE). Состояние входа сохраняется в cookie до возврата на /oidc/callback
+// @Tags auth
+// @Success 302 "Перенаправление к провайдеру"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /oidc/login [get]
+func (c *OIDCController) Login() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		authURL, state, err := c.oidc.Start()
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    state,
+			Path:     "/api/oidc",
+			MaxAge:   int(c.oidc.config.StateTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   c.secureCookies,
+			// The provider redirects back with a top-level GET, which Lax
+			// cookies are sent with.
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// Callback godoc
+// @Summary Завершение входа через OpenID Connect
+// @Description Обменивает код авторизации на ID токен провайдера и возвращает токены сервиса, как /login. При первом входе создается локальный пользователь без пароля
+// @Tags auth
+// @Produce json
+// @Param code query string true "Код авторизации"
+// @Param state query string true "Состояние, переданное провайдеру"
+// @Success 200 {object} TokenResponse "Access и refresh токены успешно созданы"
+// @Failure 400 {object} ErrorResponse "Состояние входа недействительно или истекло"
+// @Failure 401 {object} ErrorResponse "Провайдер отклонил вход или вернул недействительный ID токен"
+// @Failure 403 {object} ErrorResponse "Учетная запись отключена администратором"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /oidc/callback [get]
+func (c *OIDCController) Callback() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Path:     "/api/oidc",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   c.secureCookies,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		if reason := query.Get("error"); reason != "" {
+			if description := query.Get("error_description"); description != "" {
+				reason += ": " + description
+			}
+			responder.ErrorUnauthorized(w, errors.New("identity provider denied the login: "+reason))
+			return
+		}
+
+		cookie, err := r.Cookie(oidcStateCookie)
+		if err != nil || query.Get("code") == "" {
+			responder.ErrorBadRequest(w, ErrOIDCStateInvalid)
+			return
+		}
+
+		user, err := c.oidc.Finish(r.Context(), cookie.Value, query.Get("state"), query.Get("code"))
+		if errors.Is(err, ErrOIDCStateInvalid) {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+		if errors.Is(err, ErrOIDCTokenInvalid) || errors.Is(err, ErrOIDCCodeRejected) {
+			responder.ErrorUnauthorized(w, err)
+			return
+		}
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		if user.DisabledAt != nil {
+			recordAudit(r.Context(), c.audit, userEvent(audit.EventLoginFailure, user, map[string]string{"reason": "account_disabled", "method": "oidc"}))
+			responder.ErrorForbidden(w, ErrUserDisabled)
+			return
+		}
+
+		tokens, err := c.tokens.Issue(r.Context(), user)
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		recordAudit(r.Context(), c.audit, userEvent(audit.EventLoginSuccess, user, map[string]string{"method": "oidc"}))
+
+		outputTokens(w, c.sessions, tokens)
+	}
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"test/internal/database"
+)
+
+var oidcIdentityMigrations = []string{
+	`CREATE TABLE oidc_identities (
+		issuer     TEXT NOT NULL,
+		subject    TEXT NOT NULL,
+		user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (issuer, subject)
+	)`,
+	`CREATE INDEX oidc_identities_user_id ON oidc_identities (user_id)`,
+}
+
+type SQLiteOIDCIdentityRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteOIDCIdentityRepository must be created after the user repository
+// because oidc_identities references the users table.
+func NewSQLiteOIDCIdentityRepository(db *sql.DB) (*SQLiteOIDCIdentityRepository, error) {
+	if err := database.Migrate(db, "oidc_identities", oidcIdentityMigrations); err != nil {
+		return nil, err
+	}
+	return &SQLiteOIDCIdentityRepository{db: db}, nil
+}
+
+func (r *SQLiteOIDCIdentityRepository) Link(ctx context.Context, identity *OIDCIdentity) error {
+	identity.CreatedAt = time.Now().UTC()
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO oidc_identities (issuer, subject, user_id, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (issuer, subject) DO UPDATE SET user_id = excluded.user_id, created_at = excluded.created_at`,
+		identity.Issuer, identity.Subject, identity.UserID, identity.CreatedAt,
+	)
+	return err
+}
+
+func (r *SQLiteOIDCIdentityRepository) Get(ctx context.Context, issuer, subject string) (*OIDCIdentity, error) {
+	identity := OIDCIdentity{Issuer: issuer, Subject: subject}
+	err := r.db.QueryRowContext(ctx,
+		`SELECT user_id, created_at FROM oidc_identities WHERE issuer = ? AND subject = ?`, issuer, subject,
+	).Scan(&identity.UserID, &identity.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOIDCIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
@@ -0,0 +1,386 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const (
+	testOIDCClientID     = "hugoproxy"
+	testOIDCClientSecret = "client-secret"
+	testOIDCRedirectURL  = "http://localhost/api/oidc/callback"
+)
+
+// mockIdP is an OpenID Connect provider that serves discovery, its signing
+// keys and the token endpoint. Codes are issued by authorize instead of a
+// login page.
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    jwk.Key
+
+	mu    sync.Mutex
+	codes map[string]mockAuthorization
+}
+
+type mockAuthorization struct {
+	challenge string
+	nonce     string
+	subject   string
+	claims    map[string]interface{}
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.Set(jwk.KeyIDKey, "idp-key")
+	key.Set(jwk.AlgorithmKey, jwa.RS256)
+
+	idp := &mockIdP{t: t, key: key, codes: make(map[string]mockAuthorization)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(oidcProviderMetadata{
+		Issuer:                idp.server.URL,
+		AuthorizationEndpoint: idp.server.URL + "/authorize",
+		TokenEndpoint:         idp.server.URL + "/token",
+		JWKSURI:               idp.server.URL + "/jwks",
+	})
+}
+
+func (idp *mockIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	public, err := jwk.PublicKeyOf(idp.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	set := jwk.NewSet()
+	set.AddKey(public)
+	json.NewEncoder(w).Encode(set)
+}
+
+// token exchanges a code for an ID token after checking the client and the
+// PKCE verifier.
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		idp.tokenError(w, "invalid_request")
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != testOIDCClientID || clientSecret != testOIDCClientSecret {
+		idp.tokenError(w, "invalid_client")
+		return
+	}
+
+	idp.mu.Lock()
+	authorization, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != authorization.challenge {
+		idp.tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	builder := jwt.NewBuilder().
+		Issuer(idp.server.URL).
+		Audience([]string{testOIDCClientID}).
+		Subject(authorization.subject).
+		IssuedAt(now).
+		Expiration(now.Add(time.Minute)).
+		Claim("nonce", authorization.nonce)
+	for name, value := range authorization.claims {
+		builder = builder.Claim(name, value)
+	}
+	idToken, err := builder.Build()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	signed, err := jwt.Sign(idToken, jwt.WithKey(jwa.RS256, idp.key))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "idp-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     string(signed),
+	})
+}
+
+func (idp *mockIdP) tokenError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+// authorize plays the login page: it checks the authorization request and
+// returns the code and state the provider redirects back with.
+func (idp *mockIdP) authorize(authURL, subject string, claims map[string]interface{}) (code, state string) {
+	idp.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	query := u.Query()
+	if !strings.HasPrefix(authURL, idp.server.URL+"/authorize?") {
+		idp.t.Fatalf("auth URL %s does not point at the provider", authURL)
+	}
+	for name, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             testOIDCClientID,
+		"redirect_uri":          testOIDCRedirectURL,
+		"code_challenge_method": "S256",
+	} {
+		if got := query.Get(name); got != want {
+			idp.t.Fatalf("auth URL has %s=%q, want %q", name, got, want)
+		}
+	}
+	if query.Get("state") == "" || query.Get("nonce") == "" || query.Get("code_challenge") == "" {
+		idp.t.Fatalf("auth URL %s lacks state, nonce or code_challenge", authURL)
+	}
+
+	code, err = randomToken(16)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	idp.mu.Lock()
+	idp.codes[code] = mockAuthorization{
+		challenge: query.Get("code_challenge"),
+		nonce:     query.Get("nonce"),
+		subject:   subject,
+		claims:    claims,
+	}
+	idp.mu.Unlock()
+	return code, query.Get("state")
+}
+
+type oidcTestEnv struct {
+	idp      *mockIdP
+	service  *OIDCService
+	users    *MemoryUserRepository
+	roles    *RoleService
+	requests atomic.Int64
+}
+
+// countingTransport counts the requests made through the injected client.
+type countingTransport struct {
+	requests *atomic.Int64
+}
+
+func (t countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newOIDCTestEnv(t *testing.T) *oidcTestEnv {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	env := &oidcTestEnv{idp: newMockIdP(t), users: NewMemoryUserRepository()}
+	// alice is a configured admin, which must not be granted to an account
+	// provisioned on login.
+	env.roles = NewRoleService(NewMemoryRoleRepository(), env.users, []string{"alice"})
+	if err := env.roles.Seed(ctx); err != nil {
+		t.Fatal(err)
+	}
+	stateKey, err := newHMACKey([]byte("0123456789abcdef0123456789abcdef"), "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec, err := NewStaticKeyRing(stateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.service, err = NewOIDCService(ctx, NewMemoryOIDCIdentityRepository(), env.users, env.roles, codec, OIDCConfig{
+		Issuer:        env.idp.server.URL,
+		ClientID:      testOIDCClientID,
+		ClientSecret:  testOIDCClientSecret,
+		RedirectURL:   testOIDCRedirectURL,
+		Scopes:        []string{"openid", "profile", "email"},
+		UsernameClaim: "preferred_username",
+		EmailClaim:    "email",
+		NameClaim:     "name",
+		StateIssuer:   "hugoproxy",
+		StateTTL:      time.Minute,
+		ClockSkew:     time.Minute,
+		HTTPClient: &http.Client{
+			Timeout:   5 * time.Second,
+			Transport: countingTransport{requests: &env.requests},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func (env *oidcTestEnv) login(t *testing.T, subject string, claims map[string]interface{}) (*User, error) {
+	t.Helper()
+	authURL, signedState, err := env.service.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := env.idp.authorize(authURL, subject, claims)
+	return env.service.Finish(context.Background(), signedState, state, code)
+}
+
+func TestOIDCLoginProvisionsUser(t *testing.T) {
+	env := newOIDCTestEnv(t)
+	claims := map[string]interface{}{
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"name":               "Alice",
+	}
+
+	user, err := env.login(t, "subject-1", claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "alice" || user.Email != "alice@example.com" || user.DisplayName != "Alice" {
+		t.Errorf("provisioned %+v", user)
+	}
+	if user.EmailVerifiedAt == nil {
+		t.Error("verified email of the provider was not kept")
+	}
+	if user.PasswordHash != "" {
+		t.Error("provisioned user has a password")
+	}
+	roles, _, err := env.roles.Resolve(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 || roles[0] != RoleUser {
+		t.Errorf("provisioned user has roles %v, want only %s", roles, RoleUser)
+	}
+
+	again, err := env.login(t, "subject-1", claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != user.ID {
+		t.Errorf("second login returned user %d, want %d", again.ID, user.ID)
+	}
+	if env.requests.Load() == 0 {
+		t.Error("the configured HTTP client was not used")
+	}
+}
+
+func TestOIDCLoginDoesNotTakeOverLocalAccount(t *testing.T) {
+	env := newOIDCTestEnv(t)
+	local := &User{Username: "alice", PasswordHash: "hash"}
+	if err := env.users.Create(context.Background(), local); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := env.login(t, "subject-1", map[string]interface{}{"preferred_username": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == local.ID || !strings.HasPrefix(user.Username, "oidc-") {
+		t.Errorf("external identity was linked to %q (id %d)", user.Username, user.ID)
+	}
+}
+
+func TestOIDCLoginRejectsWrongState(t *testing.T) {
+	env := newOIDCTestEnv(t)
+	authURL, signedState, err := env.service.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := env.idp.authorize(authURL, "subject-1", nil)
+
+	if _, err := env.service.Finish(context.Background(), signedState, "forged", code); !errors.Is(err, ErrOIDCStateInvalid) {
+		t.Errorf("forged state: got %v, want %v", err, ErrOIDCStateInvalid)
+	}
+	if _, err := env.service.Finish(context.Background(), signedState+"x", "forged", code); !errors.Is(err, ErrOIDCStateInvalid) {
+		t.Errorf("tampered state cookie: got %v, want %v", err, ErrOIDCStateInvalid)
+	}
+}
+
+func TestOIDCLoginRejectsWrongNonce(t *testing.T) {
+	env := newOIDCTestEnv(t)
+	authURL, signedState, err := env.service.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := env.idp.authorize(authURL, "subject-1", nil)
+	env.idp.mu.Lock()
+	authorization := env.idp.codes[code]
+	authorization.nonce = "replayed"
+	env.idp.codes[code] = authorization
+	env.idp.mu.Unlock()
+
+	if _, err := env.service.Finish(context.Background(), signedState, state, code); !errors.Is(err, ErrOIDCTokenInvalid) {
+		t.Errorf("got %v, want %v", err, ErrOIDCTokenInvalid)
+	}
+}
+
+func TestOIDCLoginRejectsCodeOfAnotherLogin(t *testing.T) {
+	env := newOIDCTestEnv(t)
+	_, signedState, err := env.service.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherURL, _, err := env.service.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The code was issued for the other login, so the PKCE verifier of this
+	// one does not match its challenge.
+	code, _ := env.idp.authorize(otherURL, "subject-1", nil)
+	login, err := env.service.decodeState(signedState)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := env.service.Finish(context.Background(), signedState, login.State, code); !errors.Is(err, ErrOIDCCodeRejected) {
+		t.Errorf("got %v, want %v", err, ErrOIDCCodeRejected)
+	}
+	if _, total, _ := env.users.List(context.Background(), UserFilter{}); total != 0 {
+		t.Errorf("%d users were provisioned", total)
+	}
+}
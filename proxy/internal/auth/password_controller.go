@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"test/internal/responder"
+)
+
+type PasswordController struct {
+	resets *PasswordResetService
+}
+
+func NewPasswordController(resets *PasswordResetService) *PasswordController {
+	return &PasswordController{
+		resets: resets,
+	}
+}
+
+// Forgot godoc
+// @Summary Запрос восстановления пароля
+// @Description Отправляет ссылку для смены пароля на email пользователя. Ответ одинаков независимо от того, существует ли пользователь
+// @Tags auth
+// @Accept json
+// @Param request body ForgotPasswordRequest true "Имя пользователя"
+// @Success 202 "Запрос принят"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос"
+// @Router /password/forgot [post]
+func (c *PasswordController) Forgot() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data ForgotPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+		data.Username = strings.TrimSpace(data.Username)
+		if data.Username == "" {
+			responder.ErrorBadRequest(w, errors.New("username is required"))
+			return
+		}
+
+		c.resets.Forgot(data.Username)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// Reset godoc
+// @Summary Установка нового пароля
+// @Description Задает новый пароль по одноразовому токену из письма. Все сессии пользователя после этого завершаются, а его API ключи и персональные токены отзываются
+// @Tags auth
+// @Accept json
+// @Param request body ResetPasswordRequest true "Токен из письма и новый пароль"
+// @Success 204 "Пароль изменен"
+// @Failure 400 {object} ErrorResponse "Токен недействителен, истек или пароль не соответствует требованиям"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /password/reset [post]
+func (c *PasswordController) Reset() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data ResetPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+		if data.Token == "" {
+			responder.ErrorBadRequest(w, errors.New("token is required"))
+			return
+		}
+
+		err := c.resets.Reset(r.Context(), data.Token, data.Password)
+		var errs ValidationErrors
+		if errors.As(err, &errs) {
+			responder.ErrorValidation(w, errs, errs)
+			return
+		}
+		if errors.Is(err, ErrInvalidResetToken) {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// PasswordHashAlgorithm is one way of hashing passwords. Encoded hashes carry
+// the algorithm and its parameters, so hashes made with other settings can
+// still be verified.
+type PasswordHashAlgorithm interface {
+	Hash(password string) (string, error)
+	// Matches reports whether the encoded hash was made by this algorithm.
+	Matches(encoded string) bool
+	// Compare returns ErrPasswordMismatch if password does not match.
+	Compare(encoded, password string) error
+	// Outdated reports whether the hash was made with other parameters than
+	// the configured ones.
+	Outdated(encoded string) bool
+}
+
+// PasswordHasher hashes new passwords with the current algorithm and verifies
+// hashes made by any of the known ones.
+type PasswordHasher struct {
+	current    PasswordHashAlgorithm
+	algorithms []PasswordHashAlgorithm
+	// dummy is a hash of a random password made by the current algorithm,
+	// see VerifyDummy.
+	dummy string
+}
+
+// NewPasswordHasher returns a hasher that hashes with current. It hashes a
+// random password up front, so an algorithm that cannot hash with the
+// configured parameters is reported at startup.
+func NewPasswordHasher(current PasswordHashAlgorithm, others ...PasswordHashAlgorithm) (*PasswordHasher, error) {
+	secret, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	dummy, err := current.Hash(secret)
+	if err != nil {
+		return nil, fmt.Errorf("create dummy password hash: %w", err)
+	}
+	// Hashes the algorithm can not verify itself, e.g. argon2id parameters
+	// above the limits, would lock every user out.
+	if err := current.Compare(dummy, secret); err != nil {
+		return nil, fmt.Errorf("verify dummy password hash: %w", err)
+	}
+	return &PasswordHasher{
+		current:    current,
+		algorithms: append([]PasswordHashAlgorithm{current}, others...),
+		dummy:      dummy,
+	}, nil
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+// Verify returns ErrPasswordMismatch if password does not match the encoded
+// hash. needsRehash is set when the password matched but the hash was made
+// with another algorithm or outdated parameters.
+func (h *PasswordHasher) Verify(encoded, password string) (needsRehash bool, err error) {
+	for _, algorithm := range h.algorithms {
+		if !algorithm.Matches(encoded) {
+			continue
+		}
+		if err := algorithm.Compare(encoded, password); err != nil {
+			return false, err
+		}
+		return algorithm != h.current || algorithm.Outdated(encoded), nil
+	}
+	// Users without a password, such as ones provisioned by OIDC, end up
+	// here as well and must not be told apart by the response time.
+	h.VerifyDummy(password)
+	return false, ErrPasswordMismatch
+}
+
+// VerifyDummy compares the password with a hash of a random password made
+// by the current algorithm. It takes as long as Verify does for an existing
+// user, so the response time does not reveal whether a username exists.
+func (h *PasswordHasher) VerifyDummy(password string) {
+	h.current.Compare(h.dummy, password)
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (b *BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	return string(hashed), err
+}
+
+func (b *BcryptHasher) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (b *BcryptHasher) Compare(encoded, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (b *BcryptHasher) Outdated(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != b.Cost
+}
+
+// Limits for the parameters of stored argon2id hashes. A corrupted or
+// planted hash must not make every login allocate gigabytes.
+const (
+	maxArgon2idMemory     = 256 * 1024 // KiB
+	maxArgon2idIterations = 32
+	maxArgon2idKeyLength  = 1024
+)
+
+var errMalformedArgon2id = errors.New("malformed argon2id hash")
+
+// Argon2idHasher encodes hashes in the PHC string format:
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>.
+type Argon2idHasher struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (a *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a *Argon2idHasher) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (a *Argon2idHasher) Compare(encoded, password string) error {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return err
+	}
+	key := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+	if subtle.ConstantTimeCompare(key, params.key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (a *Argon2idHasher) Outdated(encoded string) bool {
+	params, err := decodeArgon2id(encoded)
+	return err != nil ||
+		params.memory != a.Memory ||
+		params.iterations != a.Iterations ||
+		params.parallelism != a.Parallelism ||
+		uint32(len(params.salt)) != a.SaltLength ||
+		uint32(len(params.key)) != a.KeyLength
+}
+
+func decodeArgon2id(encoded string) (*argon2idParams, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, errMalformedArgon2id
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, fmt.Errorf("malformed argon2id hash: %w", err)
+	}
+	if version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	var params argon2idParams
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism)
+	if err != nil {
+		return nil, fmt.Errorf("malformed argon2id hash: %w", err)
+	}
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("malformed argon2id hash: %w", err)
+	}
+	if len(params.key) == 0 || len(params.key) > maxArgon2idKeyLength ||
+		params.parallelism == 0 || params.iterations == 0 ||
+		params.memory > maxArgon2idMemory || params.iterations > maxArgon2idIterations {
+		return nil, errMalformedArgon2id
+	}
+	return &params, nil
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestArgon2idRejectsMalformedParameters(t *testing.T) {
+	hasher := &Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	const salt = "c2FsdHNhbHRzYWx0c2FsdA"
+	const key = "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+	for name, encoded := range map[string]string{
+		"empty key":      "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$",
+		"no parallelism": "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key,
+		"no iterations":  "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key,
+		"huge memory":    "$argon2id$v=19$m=4000000,t=1,p=1$" + salt + "$" + key,
+		"many passes":    "$argon2id$v=19$m=64,t=1000,p=1$" + salt + "$" + key,
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := hasher.Compare(encoded, "password")
+			if err == nil || errors.Is(err, ErrPasswordMismatch) {
+				t.Errorf("got %v, want a malformed hash error", err)
+			}
+		})
+	}
+}
+
+func TestNewPasswordHasherRejectsArgon2idAboveLimits(t *testing.T) {
+	hasher := &Argon2idHasher{Memory: 64, Iterations: maxArgon2idIterations + 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	if _, err := NewPasswordHasher(hasher); err == nil {
+		t.Error("hasher with too many iterations was accepted")
+	}
+}
@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"test/internal/audit"
+	"test/internal/mailer"
+)
+
+var (
+	ErrPasswordResetNotFound = errors.New("password reset token not found")
+	ErrPasswordResetUsed     = errors.New("password reset token already used")
+	ErrInvalidResetToken     = errors.New("password reset token is invalid or expired")
+	ErrUserHasNoEmail        = errors.New("user has no email")
+)
+
+// PasswordReset is a single use token that lets a user set a new password.
+// Only the SHA-256 hash of the token is stored.
+type PasswordReset struct {
+	ID        int64
+	TokenHash string
+	UserID    int64
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+}
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, reset *PasswordReset) error
+	GetByHash(ctx context.Context, hash string) (*PasswordReset, error)
+	// MarkUsed atomically flags the token as used and returns
+	// ErrPasswordResetUsed if it already was.
+	MarkUsed(ctx context.Context, id int64, at time.Time) error
+	// InvalidateUser marks every unused token of the user as used.
+	InvalidateUser(ctx context.Context, userID int64, at time.Time) error
+}
+
+type MemoryPasswordResetRepository struct {
+	mu     sync.Mutex
+	lastID int64
+	resets map[int64]*PasswordReset
+	byHash map[string]int64
+}
+
+func NewMemoryPasswordResetRepository() *MemoryPasswordResetRepository {
+	return &MemoryPasswordResetRepository{
+		resets: make(map[int64]*PasswordReset),
+		byHash: make(map[string]int64),
+	}
+}
+
+func (r *MemoryPasswordResetRepository) Create(ctx context.Context, reset *PasswordReset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	reset.ID = r.lastID
+	reset.CreatedAt = time.Now().UTC()
+
+	stored := *reset
+	r.resets[reset.ID] = &stored
+	r.byHash[reset.TokenHash] = reset.ID
+	return nil
+}
+
+func (r *MemoryPasswordResetRepository) GetByHash(ctx context.Context, hash string) (*PasswordReset, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.byHash[hash]
+	if !ok {
+		return nil, ErrPasswordResetNotFound
+	}
+	found := *r.resets[id]
+	return &found, nil
+}
+
+func (r *MemoryPasswordResetRepository) MarkUsed(ctx context.Context, id int64, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reset, ok := r.resets[id]
+	if !ok {
+		return ErrPasswordResetNotFound
+	}
+	if reset.UsedAt != nil {
+		return ErrPasswordResetUsed
+	}
+	reset.UsedAt = &at
+	return nil
+}
+
+func (r *MemoryPasswordResetRepository) InvalidateUser(ctx context.Context, userID int64, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, reset := range r.resets {
+		if reset.UserID == userID && reset.UsedAt == nil {
+			reset.UsedAt = &at
+		}
+	}
+	return nil
+}
+
+type PasswordResetConfig struct {
+	TTL time.Duration
+	// URL is the page of the frontend that accepts the token in the token
+	// query parameter.
+	URL string
+}
+
+// PasswordResetService mails reset links and sets new passwords with them.
+type PasswordResetService struct {
+	resets PasswordResetRepository
+	users  UserRepository
+	tokens *TokenService
+	mailer mailer.Mailer
+	policy *PasswordPolicy
+	hasher *PasswordHasher
+	guard  *LoginGuard
+	audit  audit.Logger
+	config PasswordResetConfig
+}
+
+func NewPasswordResetService(resets PasswordResetRepository, users UserRepository, tokens *TokenService, mail mailer.Mailer, policy *PasswordPolicy, hasher *PasswordHasher, guard *LoginGuard, auditLog audit.Logger, config PasswordResetConfig) *PasswordResetService {
+	return &PasswordResetService{
+		resets: resets,
+		users:  users,
+		tokens: tokens,
+		mailer: mail,
+		policy: policy,
+		hasher: hasher,
+		guard:  guard,
+		audit:  auditLog,
+		config: config,
+	}
+}
+
+// Forgot mails a reset link to the user if it exists and has an email. It
+// does the work in the background and never reports whether the user exists.
+func (s *PasswordResetService) Forgot(username string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := s.sendReset(ctx, username); err != nil {
+			log.Printf("password reset for %q: %v", username, err)
+		}
+	}()
+}
+
+func (s *PasswordResetService) sendReset(ctx context.Context, username string) error {
+	user, err := s.users.GetByUsername(ctx, username)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.mailReset(ctx, user)
+}
+
+// ForceReset clears the password of the user, revokes all their sessions,
+// API keys and personal access tokens and mails them a reset link. Until
+// the link is used the user cannot log in with a password.
+func (s *PasswordResetService) ForceReset(ctx context.Context, user *User) error {
+	if user.Email == "" {
+		return ErrUserHasNoEmail
+	}
+
+	user.PasswordHash = ""
+	if err := s.users.Update(ctx, user); err != nil {
+		return err
+	}
+	if err := s.tokens.RevokeEverything(ctx, user.ID); err != nil {
+		return err
+	}
+	return s.mailReset(ctx, user)
+}
+
+func (s *PasswordResetService) mailReset(ctx context.Context, user *User) error {
+	if user.Email == "" {
+		return ErrUserHasNoEmail
+	}
+
+	raw, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	err = s.resets.Create(ctx, &PasswordReset{
+		TokenHash: hashToken(raw),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(s.config.TTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.config.URL + "?token=" + url.QueryEscape(raw)
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Восстановление пароля",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\nЧтобы задать новый пароль, перейдите по ссылке:\n%s\n\n"+
+			"Ссылка действительна %d мин. и может быть использована один раз. "+
+			"Если вы не запрашивали восстановление пароля, просто проигнорируйте это письмо.\n",
+			user.Username, link, int(s.config.TTL.Minutes())),
+	})
+}
+
+// Reset sets a new password with a reset token. All other reset tokens, all
+// sessions and all API keys and personal access tokens of the user are
+// revoked, and the lockout of the username is lifted. A password that
+// violates the policy is reported as ValidationErrors without using up the
+// token.
+func (s *PasswordResetService) Reset(ctx context.Context, rawToken, password string) error {
+	reset, err := s.resets.GetByHash(ctx, hashToken(rawToken))
+	if errors.Is(err, ErrPasswordResetNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if reset.UsedAt != nil || now.After(reset.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	user, err := s.users.GetByID(ctx, reset.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	if reason := s.policy.Validate(password, user.Username); reason != "" {
+		return ValidationErrors{"password": reason}
+	}
+
+	if err := s.resets.MarkUsed(ctx, reset.ID, now); err != nil {
+		if errors.Is(err, ErrPasswordResetUsed) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	passwordHash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = passwordHash
+	if err := s.users.Update(ctx, user); err != nil {
+		return err
+	}
+
+	if err := s.resets.InvalidateUser(ctx, user.ID, now); err != nil {
+		return err
+	}
+	// The owner of the mailbox proved who they are, so the failures an
+	// attacker may have caused no longer lock them out.
+	s.guard.Success(user.Username)
+	recordAudit(ctx, s.audit, userEvent(audit.EventPasswordReset, user, nil))
+	return s.tokens.RevokeEverything(ctx, user.ID)
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"test/internal/database"
+)
+
+var passwordResetMigrations = []string{
+	`CREATE TABLE password_resets (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		token_hash TEXT NOT NULL UNIQUE,
+		user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		used_at    TIMESTAMP
+	)`,
+	`CREATE INDEX password_resets_user_id ON password_resets (user_id)`,
+}
+
+type SQLitePasswordResetRepository struct {
+	db *sql.DB
+}
+
+func NewSQLitePasswordResetRepository(db *sql.DB) (*SQLitePasswordResetRepository, error) {
+	if err := database.Migrate(db, "password_resets", passwordResetMigrations); err != nil {
+		return nil, err
+	}
+	return &SQLitePasswordResetRepository{db: db}, nil
+}
+
+func (r *SQLitePasswordResetRepository) Create(ctx context.Context, reset *PasswordReset) error {
+	reset.CreatedAt = time.Now().UTC()
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO password_resets (token_hash, user_id, expires_at, created_at) VALUES (?, ?, ?, ?)`,
+		reset.TokenHash, reset.UserID, reset.ExpiresAt.UTC(), reset.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	reset.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *SQLitePasswordResetRepository) GetByHash(ctx context.Context, hash string) (*PasswordReset, error) {
+	var reset PasswordReset
+	var usedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, token_hash, user_id, expires_at, created_at, used_at FROM password_resets WHERE token_hash = ?`, hash,
+	).Scan(&reset.ID, &reset.TokenHash, &reset.UserID, &reset.ExpiresAt, &reset.CreatedAt, &usedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPasswordResetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		reset.UsedAt = &usedAt.Time
+	}
+	return &reset, nil
+}
+
+func (r *SQLitePasswordResetRepository) MarkUsed(ctx context.Context, id int64, at time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE password_resets SET used_at = ? WHERE id = ? AND used_at IS NULL`, at.UTC(), id,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPasswordResetUsed
+	}
+	return nil
+}
+
+func (r *SQLitePasswordResetRepository) InvalidateUser(ctx context.Context, userID int64, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL`, at.UTC(), userID,
+	)
+	return err
+}
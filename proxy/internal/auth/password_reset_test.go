@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestResetLiftsUsernameLockout(t *testing.T) {
+	ctx := context.Background()
+	hasher, err := NewPasswordHasher(&BcryptHasher{Cost: bcrypt.MinCost})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := NewMemoryUserRepository()
+	user := &User{Username: "Alice"}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	guard := NewLoginGuard(LockoutConfig{
+		MaxFailures:      3,
+		MaxFailuresPerIP: 3,
+		BaseLockout:      time.Hour,
+		MaxLockout:       time.Hour,
+		ResetAfter:       time.Hour,
+	}, nil)
+	for i := 0; i < 3; i++ {
+		guard.Failure(ctx, "alice", "10.0.0.1")
+	}
+	if guard.Check("alice", "10.0.0.2") == 0 {
+		t.Fatal("username is not locked")
+	}
+
+	resets := NewMemoryPasswordResetRepository()
+	if err := resets.Create(ctx, &PasswordReset{
+		TokenHash: hashToken("reset-token"),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	tokens := NewTokenService(nil, NewMemoryRefreshTokenRepository(), users, nil, NewDenylist(nil, time.Minute), nil, nil, TokenConfig{})
+	s := NewPasswordResetService(resets, users, tokens, nil, &PasswordPolicy{MinLength: 8}, hasher, guard, nil, PasswordResetConfig{})
+
+	if err := s.Reset(ctx, "reset-token", "a new long password"); err != nil {
+		t.Fatal(err)
+	}
+	if d := guard.Check("alice", "10.0.0.2"); d != 0 {
+		t.Errorf("username is still locked for %v after the reset", d)
+	}
+	// The address the attack came from stays locked.
+	if guard.Check("bob", "10.0.0.1") == 0 {
+		t.Error("the lockout of the address was lifted")
+	}
+}
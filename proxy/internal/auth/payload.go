@@ -1,12 +1,277 @@
 package auth
 
-type User struct {
+import (
+	"time"
+
+	"test/internal/audit"
+	"test/internal/tenant"
+)
+
+type Credentials struct {
 	Username string `json:"username" example:"user"`
 	Password string `json:"password" example:"password123"`
 }
 
+type RegisterRequest struct {
+	Username string `json:"username" example:"user"`
+	Email    string `json:"email,omitempty" example:"user@example.com"`
+	Password string `json:"password" example:"Password123"`
+}
+
 type TokenResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type" example:"Bearer"`
+	ExpiresIn    int64  `json:"expires_in" example:"900"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token,omitempty"`
 }
 
 type TokenClaims map[string]interface{}
+
+type UserProfile struct {
+	ID            int64     `json:"id" example:"1"`
+	Username      string    `json:"username" example:"user"`
+	DisplayName   string    `json:"display_name,omitempty" example:"Иван Петров"`
+	Email         string    `json:"email,omitempty" example:"user@example.com"`
+	EmailVerified bool      `json:"email_verified"`
+	TenantID      int64     `json:"tenant_id,omitempty" example:"1"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type TokenInfo struct {
+	ID          string    `json:"jti"`
+	Issuer      string    `json:"iss" example:"hugoproxy"`
+	Audience    []string  `json:"aud"`
+	IssuedAt    time.Time `json:"iat"`
+	ExpiresAt   time.Time `json:"exp"`
+	Roles       []string  `json:"roles" example:"user"`
+	Permissions []string  `json:"permissions" example:"address:search,address:geocode"`
+	// PersonalTokenID is set for personal access tokens. Their iat is the
+	// creation time and exp is zero if the token does not expire.
+	PersonalTokenID int64 `json:"personal_token_id,omitempty" example:"1"`
+}
+
+type MeResponse struct {
+	User  UserProfile `json:"user"`
+	Token TokenInfo   `json:"token"`
+}
+
+func NewUserProfile(user *User) UserProfile {
+	return UserProfile{
+		ID:            user.ID,
+		Username:      user.Username,
+		DisplayName:   user.DisplayName,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		TenantID:      user.TenantID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+	}
+}
+
+type UnlockRequest struct {
+	Kind    string `json:"kind" example:"username"`
+	Subject string `json:"subject" example:"user"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" example:"nightly import"`
+	Scopes []string `json:"scopes" example:"address:search"`
+}
+
+type CreatePersonalTokenRequest struct {
+	Name   string   `json:"name" example:"report script"`
+	Scopes []string `json:"scopes" example:"address:search"`
+	// ExpiresAt is optional, the token does not expire without it.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type PersonalTokenResponse struct {
+	ID         int64      `json:"id" example:"1"`
+	Name       string     `json:"name" example:"report script"`
+	Prefix     string     `json:"prefix" example:"5be0a3c1d94e7f20"`
+	Scopes     []string   `json:"scopes" example:"address:search"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// Token is only returned once, when the token is created.
+	Token string `json:"token,omitempty" example:"hpat_5be0a3c1d94e7f20_Zm9vYmFy..."`
+}
+
+func NewPersonalTokenResponse(token *PersonalAccessToken) PersonalTokenResponse {
+	return PersonalTokenResponse{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.Scopes,
+		CreatedAt:  token.CreatedAt,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		RevokedAt:  token.RevokedAt,
+	}
+}
+
+type APIKeyResponse struct {
+	ID         int64      `json:"id" example:"1"`
+	Name       string     `json:"name" example:"nightly import"`
+	Prefix     string     `json:"prefix" example:"9f86d081884c7d65"`
+	Scopes     []string   `json:"scopes" example:"address:search"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// Key is only returned once, when the key is created.
+	Key string `json:"key,omitempty" example:"hp_9f86d081884c7d65_Zm9vYmFy..."`
+}
+
+func NewAPIKeyResponse(key *APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
+
+type ForgotPasswordRequest struct {
+	Username string `json:"username" example:"user"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password" example:"NewPassword123"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" example:"Password123"`
+	NewPassword     string `json:"new_password" example:"NewPassword123"`
+}
+
+// UpdateProfileRequest changes only the fields that are present.
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name,omitempty" example:"Иван Петров"`
+	Email       *string `json:"email,omitempty" example:"user@example.com"`
+}
+
+// MFAChallengeResponse is returned by Login instead of TokenResponse when the
+// user has two-factor authentication enabled.
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required" example:"true"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in" example:"300"`
+}
+
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	// Code is a TOTP code or a recovery code.
+	Code string `json:"code" example:"123456"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" example:"123456"`
+}
+
+type MFAStatusResponse struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left" example:"10"`
+}
+
+type TOTPEnrollResponse struct {
+	Secret     string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	OTPAuthURI string `json:"otpauth_uri" example:"otpauth://totp/HugoProxy:user?secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP&issuer=HugoProxy"`
+	// QRCode is a PNG image of OTPAuthURI, base64 encoded.
+	QRCode []byte `json:"qr_code" swaggertype:"string" format:"base64"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"k3d9x-7pq2m"`
+}
+
+type AdminUserResponse struct {
+	UserProfile
+	Roles      []string   `json:"roles" example:"user"`
+	MFAEnabled bool       `json:"mfa_enabled"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+}
+
+type AdminUserListResponse struct {
+	Users   []AdminUserResponse `json:"users"`
+	Total   int                 `json:"total" example:"42"`
+	Page    int                 `json:"page" example:"1"`
+	PerPage int                 `json:"per_page" example:"20"`
+}
+
+type SetRolesRequest struct {
+	Roles []string `json:"roles" example:"user,admin"`
+}
+
+type AuditEventListResponse struct {
+	Events  []audit.Event `json:"events"`
+	Total   int           `json:"total" example:"42"`
+	Page    int           `json:"page" example:"1"`
+	PerPage int           `json:"per_page" example:"20"`
+}
+
+// TenantRequest creates a tenant or, in PATCH requests, changes only the
+// fields that are present. Empty DaData keys make the tenant use the
+// default ones.
+type TenantRequest struct {
+	Name            *string `json:"name,omitempty" example:"logistics"`
+	DaDataAPIKey    *string `json:"dadata_api_key,omitempty"`
+	DaDataSecretKey *string `json:"dadata_secret_key,omitempty"`
+	RateLimit       *int    `json:"rate_limit,omitempty" example:"60"`
+	DailyQuota      *int    `json:"daily_quota,omitempty" example:"10000"`
+}
+
+type TenantResponse struct {
+	ID   int64  `json:"id" example:"1"`
+	Name string `json:"name" example:"logistics"`
+	// The keys themselves are never returned.
+	HasGeoCredentials bool         `json:"has_geo_credentials"`
+	RateLimit         int          `json:"rate_limit" example:"60"`
+	DailyQuota        int          `json:"daily_quota" example:"10000"`
+	Users             int          `json:"users" example:"12"`
+	Usage             tenant.Usage `json:"usage"`
+	CreatedAt         time.Time    `json:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+}
+
+type SetTenantRequest struct {
+	// TenantID 0 removes the user from their tenant.
+	TenantID int64 `json:"tenant_id" example:"1"`
+}
+
+// IntrospectionResponse follows RFC 7662. Inactive tokens are described by
+// "active": false alone.
+type IntrospectionResponse struct {
+	Active bool `json:"active"`
+	// Scope lists the permissions of the token separated by spaces.
+	Scope     string   `json:"scope,omitempty" example:"address:search address:geocode"`
+	Subject   string   `json:"sub,omitempty" example:"1"`
+	Username  string   `json:"username,omitempty" example:"john_doe"`
+	TokenType string   `json:"token_type,omitempty" example:"access_token"`
+	ExpiresAt int64    `json:"exp,omitempty" example:"1760800000"`
+	IssuedAt  int64    `json:"iat,omitempty" example:"1760799100"`
+	NotBefore int64    `json:"nbf,omitempty" example:"1760799100"`
+	Issuer    string   `json:"iss,omitempty" example:"hugoproxy"`
+	Audience  []string `json:"aud,omitempty"`
+	TokenID   string   `json:"jti,omitempty"`
+	TenantID  int64    `json:"tenant_id,omitempty" example:"1"`
+}
+
+// IntrospectionError is an OAuth 2.0 error response (RFC 6749, section 5.2).
+type IntrospectionError struct {
+	Error       string `json:"error" example:"invalid_client"`
+	Description string `json:"error_description,omitempty"`
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrPersonalTokenNotFound = errors.New("personal access token not found")
+	ErrInvalidPersonalToken  = errors.New("personal access token is invalid, expired or revoked")
+	ErrPersonalTokenDenied   = errors.New("personal access tokens can not be used here")
+)
+
+// PersonalAccessToken is a credential a user creates for scripts. It is sent
+// as a bearer token, only grants its scopes and may expire.
+type PersonalAccessToken = Credential
+
+var personalTokenKind = credentialKind{
+	prefix:   "hpat",
+	name:     "personal access token",
+	notFound: ErrPersonalTokenNotFound,
+	invalid:  ErrInvalidPersonalToken,
+}
+
+// PersonalTokenService creates personal access tokens and authenticates
+// requests made with them.
+type PersonalTokenService struct {
+	credentialStore
+}
+
+func NewPersonalTokenService(tokens CredentialRepository, users UserRepository, roles *RoleService) *PersonalTokenService {
+	return &PersonalTokenService{credentialStore{kind: personalTokenKind, repo: tokens, users: users, roles: roles}}
+}
+
+// Create issues a token with the given scopes and returns it together with
+// the raw token, which is not stored and can not be shown again. expiresAt
+// may be nil for a token that does not expire.
+func (s *PersonalTokenService) Create(ctx context.Context, userID int64, name string, scopes []string, expiresAt *time.Time) (*PersonalAccessToken, string, error) {
+	return s.create(ctx, userID, name, scopes, expiresAt)
+}
+
+// Authenticate resolves a raw token to the claims of its owner. The token
+// only grants those of its scopes that the owner's roles still allow.
+func (s *PersonalTokenService) Authenticate(ctx context.Context, raw string) (*Claims, error) {
+	token, claims, err := s.authenticate(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	claims.PersonalTokenID = token.ID
+	claims.IssuedAt = token.CreatedAt
+	if token.ExpiresAt != nil {
+		claims.ExpiresAt = *token.ExpiresAt
+	}
+	return claims, nil
+}
+
+// isPersonalToken reports whether the raw bearer token looks like a personal
+// access token rather than a JWT.
+func isPersonalToken(raw string) bool {
+	return personalTokenKind.matches(raw)
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"test/internal/audit"
+	"test/internal/responder"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type PersonalTokenController struct {
+	tokens *PersonalTokenService
+	audit  audit.Logger
+}
+
+func NewPersonalTokenController(tokens *PersonalTokenService, auditLog audit.Logger) *PersonalTokenController {
+	return &PersonalTokenController{
+		tokens: tokens,
+		audit:  auditLog,
+	}
+}
+
+// Create godoc
+// @Summary Создание персонального токена
+// @Description Создает персональный токен доступа для скриптов. Токен возвращается только один раз. Scopes должны входить в разрешения текущего пользователя, срок действия необязателен
+// @Tags personal-tokens
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreatePersonalTokenRequest true "Название, разрешения и срок действия токена"
+// @Success 200 {object} PersonalTokenResponse "Токен создан"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос или ошибки валидации полей"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Запрос выполнен с персональным токеном"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /me/tokens [post]
+func (c *PersonalTokenController) Create() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data CreatePersonalTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+
+		claims, _ := ClaimsFromContext(r.Context())
+		data.Name = strings.TrimSpace(data.Name)
+		errs := ValidationErrors{}
+		if data.Name == "" {
+			errs["name"] = "is required"
+		} else if len(data.Name) > maxAPIKeyNameLength {
+			errs["name"] = "must be at most " + strconv.Itoa(maxAPIKeyNameLength) + " characters"
+		}
+		if len(data.Scopes) == 0 {
+			errs["scopes"] = "at least one scope is required"
+		}
+		for _, scope := range data.Scopes {
+			if !claims.HasPermission(scope) {
+				errs["scopes"] = "scope " + scope + " is not granted to you"
+				break
+			}
+		}
+		if data.ExpiresAt != nil && !data.ExpiresAt.After(time.Now()) {
+			errs["expires_at"] = "must be in the future"
+		}
+		if len(errs) > 0 {
+			responder.ErrorValidation(w, errs, errs)
+			return
+		}
+
+		var expiresAt *time.Time
+		if data.ExpiresAt != nil {
+			utc := data.ExpiresAt.UTC()
+			expiresAt = &utc
+		}
+		token, raw, err := c.tokens.Create(r.Context(), claims.UserID(), data.Name, data.Scopes, expiresAt)
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		c.record(r, audit.EventPersonalTokenCreate, token)
+
+		res := NewPersonalTokenResponse(token)
+		res.Token = raw
+		responder.OutputJSON(w, res)
+	}
+}
+
+// List godoc
+// @Summary Список персональных токенов
+// @Description Возвращает персональные токены текущего пользователя, включая отозванные и истекшие, с временем последнего использования. Сами токены не возвращаются
+// @Tags personal-tokens
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} PersonalTokenResponse
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Запрос выполнен с персональным токеном"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /me/tokens [get]
+func (c *PersonalTokenController) List() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := ClaimsFromContext(r.Context())
+		tokens, err := c.tokens.List(r.Context(), claims.UserID())
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		res := make([]PersonalTokenResponse, 0, len(tokens))
+		for i := range tokens {
+			res = append(res, NewPersonalTokenResponse(&tokens[i]))
+		}
+		responder.OutputJSON(w, res)
+	}
+}
+
+// Revoke godoc
+// @Summary Отзыв персонального токена
+// @Description Отзывает персональный токен текущего пользователя. Запросы с этим токеном сразу перестают приниматься
+// @Tags personal-tokens
+// @Security BearerAuth
+// @Param id path int true "ID токена"
+// @Success 204 "Токен отозван"
+// @Failure 400 {object} ErrorResponse "Некорректный ID"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Запрос выполнен с персональным токеном"
+// @Failure 404 {object} ErrorResponse "Токен не найден"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /me/tokens/{id} [delete]
+func (c *PersonalTokenController) Revoke() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			responder.ErrorBadRequest(w, errors.New("invalid token id"))
+			return
+		}
+
+		claims, _ := ClaimsFromContext(r.Context())
+		if err := c.tokens.Revoke(r.Context(), claims.UserID(), id); err != nil {
+			if errors.Is(err, ErrPersonalTokenNotFound) {
+				responder.ErrorNotFound(w, err)
+				return
+			}
+			responder.ErrorInternal(w, err)
+			return
+		}
+		c.record(r, audit.EventPersonalTokenRevoke, &PersonalAccessToken{ID: id})
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (c *PersonalTokenController) record(r *http.Request, eventType string, token *PersonalAccessToken) {
+	claims, _ := ClaimsFromContext(r.Context())
+	details := map[string]string{"token_id": strconv.FormatInt(token.ID, 10)}
+	if token.Name != "" {
+		details["name"] = token.Name
+		details["scopes"] = strings.Join(token.Scopes, " ")
+	}
+	recordAudit(r.Context(), c.audit, audit.Event{
+		Type:     eventType,
+		UserID:   claims.UserID(),
+		Username: claims.Username,
+		TenantID: claims.TenantID,
+		Details:  details,
+	})
+}
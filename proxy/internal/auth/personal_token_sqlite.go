@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"database/sql"
+
+	"test/internal/database"
+)
+
+var personalTokenMigrations = []string{
+	`CREATE TABLE personal_access_tokens (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id      INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name         TEXT NOT NULL,
+		prefix       TEXT NOT NULL UNIQUE,
+		token_hash   TEXT NOT NULL,
+		scopes       TEXT NOT NULL,
+		created_at   TIMESTAMP NOT NULL,
+		expires_at   TIMESTAMP,
+		last_used_at TIMESTAMP,
+		revoked_at   TIMESTAMP
+	)`,
+	`CREATE INDEX personal_access_tokens_user_id ON personal_access_tokens (user_id)`,
+	`ALTER TABLE personal_access_tokens RENAME COLUMN token_hash TO secret_hash`,
+}
+
+func NewSQLitePersonalTokenRepository(db *sql.DB) (*SQLiteCredentialRepository, error) {
+	if err := database.Migrate(db, "personal_access_tokens", personalTokenMigrations); err != nil {
+		return nil, err
+	}
+	return &SQLiteCredentialRepository{db: db, table: "personal_access_tokens"}, nil
+}
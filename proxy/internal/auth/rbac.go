@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+)
+
+// RoleService assigns roles to users and resolves the permissions that are
+// embedded into their access tokens.
+type RoleService struct {
+	roles  RoleRepository
+	users  UserRepository
+	admins map[string]struct{}
+}
+
+// NewRoleService returns a service that additionally grants the admin role to
+// the listed usernames at startup. Only accounts that already exist are
+// promoted, so the list cannot be used to claim admin by registering one of
+// the names.
+func NewRoleService(roles RoleRepository, users UserRepository, admins []string) *RoleService {
+	s := &RoleService{
+		roles:  roles,
+		users:  users,
+		admins: make(map[string]struct{}, len(admins)),
+	}
+	for _, username := range admins {
+		s.admins[strings.ToLower(username)] = struct{}{}
+	}
+	return s
+}
+
+// Seed creates the default roles and grants the admin role to the configured
+// admins that are already registered.
+func (s *RoleService) Seed(ctx context.Context) error {
+	for i := range DefaultRoles {
+		if err := s.roles.EnsureRole(ctx, &DefaultRoles[i]); err != nil {
+			return err
+		}
+	}
+
+	for username := range s.admins {
+		user, err := s.users.GetByUsername(ctx, username)
+		if errors.Is(err, ErrUserNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.roles.AssignRole(ctx, user.ID, RoleAdmin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AssignDefaults grants the roles every new user starts with. Self-service
+// accounts never get the admin role here, even if the username is listed in
+// ADMIN_USERNAMES; see Seed.
+func (s *RoleService) AssignDefaults(ctx context.Context, user *User) error {
+	return s.roles.AssignRole(ctx, user.ID, RoleUser)
+}
+
+// SetRoles replaces the roles of the user. Configured admins get the admin
+// role back at the next start.
+func (s *RoleService) SetRoles(ctx context.Context, userID int64, roles []string) error {
+	return s.roles.SetUserRoles(ctx, userID, roles)
+}
+
+// Resolve returns the roles of the user and the union of their permissions,
+// both sorted.
+func (s *RoleService) Resolve(ctx context.Context, userID int64) ([]string, []string, error) {
+	roles, err := s.roles.UserRoles(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	set := make(map[string]struct{})
+	for _, name := range roles {
+		role, err := s.roles.GetRole(ctx, name)
+		if errors.Is(err, ErrRoleNotFound) {
+			log.Printf("user %d has unknown role %q", userID, name)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, permission := range role.Permissions {
+			set[permission] = struct{}{}
+		}
+	}
+
+	permissions := make([]string, 0, len(set))
+	for permission := range set {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return roles, permissions, nil
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenUsed     = errors.New("refresh token already used")
+)
+
+// RefreshToken is the server side record of an opaque refresh token. Only the
+// SHA-256 hash of the token is stored. Tokens issued by rotating one another
+// share a FamilyID so that a replayed token can revoke the whole chain.
+type RefreshToken struct {
+	ID        int64
+	TokenHash string
+	FamilyID  string
+	UserID    int64
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *RefreshToken) error
+	GetByHash(ctx context.Context, hash string) (*RefreshToken, error)
+	// MarkUsed atomically flags the token as used and returns
+	// ErrRefreshTokenUsed if it already was.
+	MarkUsed(ctx context.Context, id int64, at time.Time) error
+	RevokeFamily(ctx context.Context, familyID string, at time.Time) error
+	RevokeUser(ctx context.Context, userID int64, at time.Time) error
+}
+
+type MemoryRefreshTokenRepository struct {
+	mu     sync.Mutex
+	lastID int64
+	tokens map[int64]*RefreshToken
+	byHash map[string]int64
+}
+
+func NewMemoryRefreshTokenRepository() *MemoryRefreshTokenRepository {
+	return &MemoryRefreshTokenRepository{
+		tokens: make(map[int64]*RefreshToken),
+		byHash: make(map[string]int64),
+	}
+}
+
+func (r *MemoryRefreshTokenRepository) Create(ctx context.Context, token *RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	token.ID = r.lastID
+	token.CreatedAt = time.Now().UTC()
+
+	stored := *token
+	r.tokens[token.ID] = &stored
+	r.byHash[token.TokenHash] = token.ID
+	return nil
+}
+
+func (r *MemoryRefreshTokenRepository) GetByHash(ctx context.Context, hash string) (*RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.byHash[hash]
+	if !ok {
+		return nil, ErrRefreshTokenNotFound
+	}
+	found := *r.tokens[id]
+	return &found, nil
+}
+
+func (r *MemoryRefreshTokenRepository) MarkUsed(ctx context.Context, id int64, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[id]
+	if !ok {
+		return ErrRefreshTokenNotFound
+	}
+	if token.UsedAt != nil {
+		return ErrRefreshTokenUsed
+	}
+	token.UsedAt = &at
+	return nil
+}
+
+func (r *MemoryRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, token := range r.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRefreshTokenRepository) RevokeUser(ctx context.Context, userID int64, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, token := range r.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &at
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"test/internal/database"
+)
+
+var refreshTokenMigrations = []string{
+	`CREATE TABLE refresh_tokens (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		token_hash TEXT NOT NULL UNIQUE,
+		family_id  TEXT NOT NULL,
+		user_id    INTEGER NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		used_at    TIMESTAMP,
+		revoked_at TIMESTAMP
+	)`,
+	`CREATE INDEX refresh_tokens_family_id ON refresh_tokens (family_id)`,
+	`CREATE INDEX refresh_tokens_user_id ON refresh_tokens (user_id)`,
+}
+
+type SQLiteRefreshTokenRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRefreshTokenRepository(db *sql.DB) (*SQLiteRefreshTokenRepository, error) {
+	if err := database.Migrate(db, "refresh_tokens", refreshTokenMigrations); err != nil {
+		return nil, err
+	}
+	return &SQLiteRefreshTokenRepository{db: db}, nil
+}
+
+func (r *SQLiteRefreshTokenRepository) Create(ctx context.Context, token *RefreshToken) error {
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (token_hash, family_id, user_id, expires_at, created_at) VALUES (?, ?, ?, ?, ?)`,
+		token.TokenHash, token.FamilyID, token.UserID, token.ExpiresAt.UTC(), now,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	token.ID = id
+	token.CreatedAt = now
+	return nil
+}
+
+func (r *SQLiteRefreshTokenRepository) GetByHash(ctx context.Context, hash string) (*RefreshToken, error) {
+	var token RefreshToken
+	var usedAt, revokedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, token_hash, family_id, user_id, expires_at, created_at, used_at, revoked_at
+		FROM refresh_tokens WHERE token_hash = ?`, hash,
+	).Scan(&token.ID, &token.TokenHash, &token.FamilyID, &token.UserID, &token.ExpiresAt, &token.CreatedAt, &usedAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
+
+func (r *SQLiteRefreshTokenRepository) MarkUsed(ctx context.Context, id int64, at time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL`, at.UTC(), id,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrRefreshTokenUsed
+	}
+	return nil
+}
+
+func (r *SQLiteRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL`, at.UTC(), familyID,
+	)
+	return err
+}
+
+func (r *SQLiteRefreshTokenRepository) RevokeUser(ctx context.Context, userID int64, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, at.UTC(), userID,
+	)
+	return err
+}
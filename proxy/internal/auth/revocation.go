@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	RevocationToken = "token"
+	RevocationUser  = "user"
+)
+
+// Revocation is a persisted denylist entry. For RevocationToken the Subject
+// is the token jti, for RevocationUser it is the user ID and every token of
+// that user issued before RevokedAt is rejected.
+type Revocation struct {
+	Kind      string
+	Subject   string
+	RevokedAt time.Time
+	ExpiresAt time.Time
+}
+
+type RevocationRepository interface {
+	Save(ctx context.Context, revocation Revocation) error
+	ListActive(ctx context.Context, now time.Time) ([]Revocation, error)
+	DeleteExpired(ctx context.Context, now time.Time) error
+}
+
+// Denylist keeps revoked access tokens in memory until they would have expired
+// anyway. When a RevocationRepository is set, entries are also written there and
+// loaded back on startup so revocations survive restarts.
+type Denylist struct {
+	mu       sync.RWMutex
+	tokens   map[string]time.Time
+	users    map[int64]Revocation
+	store    RevocationRepository
+	tokenTTL time.Duration
+}
+
+func NewDenylist(store RevocationRepository, tokenTTL time.Duration) *Denylist {
+	return &Denylist{
+		tokens:   make(map[string]time.Time),
+		users:    make(map[int64]Revocation),
+		store:    store,
+		tokenTTL: tokenTTL,
+	}
+}
+
+// Load restores the still active revocations from the repository.
+func (d *Denylist) Load(ctx context.Context) error {
+	if d.store == nil {
+		return nil
+	}
+	revocations, err := d.store.ListActive(ctx, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, rev := range revocations {
+		d.remember(rev)
+	}
+	return nil
+}
+
+func (d *Denylist) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return d.add(ctx, Revocation{
+		Kind:      RevocationToken,
+		Subject:   jti,
+		RevokedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt.UTC(),
+	})
+}
+
+// RevokeUser rejects every access token of the user issued up to now.
+func (d *Denylist) RevokeUser(ctx context.Context, userID int64) error {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	return d.add(ctx, Revocation{
+		Kind:      RevocationUser,
+		Subject:   strconv.FormatInt(userID, 10),
+		RevokedAt: now,
+		ExpiresAt: now.Add(d.tokenTTL),
+	})
+}
+
+func (d *Denylist) add(ctx context.Context, rev Revocation) error {
+	if d.store != nil {
+		if err := d.store.Save(ctx, rev); err != nil {
+			return err
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.remember(rev)
+	return nil
+}
+
+func (d *Denylist) remember(rev Revocation) {
+	switch rev.Kind {
+	case RevocationToken:
+		d.tokens[rev.Subject] = rev.ExpiresAt
+	case RevocationUser:
+		userID, err := strconv.ParseInt(rev.Subject, 10, 64)
+		if err != nil {
+			return
+		}
+		if current, ok := d.users[userID]; !ok || rev.RevokedAt.After(current.RevokedAt) {
+			d.users[userID] = rev
+		}
+	}
+}
+
+// IsRevoked reports whether the token with the given jti, owner and issue time
+// was revoked. Tokens without iat_us only carry whole seconds, so a user
+// revocation also covers those issued later within the same second.
+func (d *Denylist) IsRevoked(jti string, userID int64, issuedAt time.Time) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if _, ok := d.tokens[jti]; ok {
+		return true
+	}
+	if rev, ok := d.users[userID]; ok && !issuedAt.After(rev.RevokedAt) {
+		return true
+	}
+	return false
+}
+
+// IssueTime returns the issue time for a new token of the user: now in
+// microseconds, moved past the latest revocation of the user if that
+// happened within the same microsecond, so the new token is never covered by
+// it.
+func (d *Denylist) IssueTime(userID int64) time.Time {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if rev, ok := d.users[userID]; ok && !now.After(rev.RevokedAt) {
+		return rev.RevokedAt.Add(time.Microsecond)
+	}
+	return now
+}
+
+// Cleanup drops entries whose tokens have expired on their own.
+func (d *Denylist) Cleanup(ctx context.Context) {
+	now := time.Now().UTC()
+
+	d.mu.Lock()
+	for jti, expiresAt := range d.tokens {
+		if now.After(expiresAt) {
+			delete(d.tokens, jti)
+		}
+	}
+	for userID, rev := range d.users {
+		if now.After(rev.ExpiresAt) {
+			delete(d.users, userID)
+		}
+	}
+	d.mu.Unlock()
+
+	if d.store != nil {
+		if err := d.store.DeleteExpired(ctx, now); err != nil {
+			log.Println("denylist cleanup:", err)
+		}
+	}
+}
+
+// StartCleanup runs Cleanup every interval until ctx is done.
+func (d *Denylist) StartCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.Cleanup(ctx)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"test/internal/database"
+)
+
+var revocationMigrations = []string{
+	`CREATE TABLE token_revocations (
+		kind       TEXT NOT NULL,
+		subject    TEXT NOT NULL,
+		revoked_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (kind, subject)
+	)`,
+}
+
+type SQLiteRevocationRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRevocationRepository(db *sql.DB) (*SQLiteRevocationRepository, error) {
+	if err := database.Migrate(db, "token_revocations", revocationMigrations); err != nil {
+		return nil, err
+	}
+	return &SQLiteRevocationRepository{db: db}, nil
+}
+
+func (r *SQLiteRevocationRepository) Save(ctx context.Context, rev Revocation) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO token_revocations (kind, subject, revoked_at, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (kind, subject) DO UPDATE SET revoked_at = excluded.revoked_at, expires_at = excluded.expires_at`,
+		rev.Kind, rev.Subject, rev.RevokedAt.UTC(), rev.ExpiresAt.UTC(),
+	)
+	return err
+}
+
+func (r *SQLiteRevocationRepository) ListActive(ctx context.Context, now time.Time) ([]Revocation, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT kind, subject, revoked_at, expires_at FROM token_revocations WHERE expires_at > ?`, now.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []Revocation
+	for rows.Next() {
+		var rev Revocation
+		if err := rows.Scan(&rev.Kind, &rev.Subject, &rev.RevokedAt, &rev.ExpiresAt); err != nil {
+			return nil, err
+		}
+		res = append(res, rev)
+	}
+	return res, rows.Err()
+}
+
+func (r *SQLiteRevocationRepository) DeleteExpired(ctx context.Context, now time.Time) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM token_revocations WHERE expires_at <= ?`, now.UTC())
+	return err
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+var ErrRoleNotFound = errors.New("role not found")
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+const (
+	PermissionAddressSearch  = "address:search"
+	PermissionAddressGeocode = "address:geocode"
+	PermissionProfileRead    = "profile:read"
+	PermissionTokensRevoke   = "tokens:revoke"
+	PermissionKeysManage     = "keys:manage"
+	PermissionUsersManage    = "users:manage"
+	PermissionAuditRead      = "audit:read"
+	PermissionTenantsManage  = "tenants:manage"
+)
+
+// Role is a named set of permissions. Users get permissions only through
+// their roles.
+type Role struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// DefaultRoles are created at startup if they do not exist yet. Permissions
+// added to a default role in a later release are granted to the existing
+// role as well; other permissions of the role are left untouched.
+var DefaultRoles = []Role{
+	{
+		Name:        RoleUser,
+		Permissions: []string{PermissionAddressSearch, PermissionAddressGeocode, PermissionProfileRead},
+	},
+	{
+		Name: RoleAdmin,
+		Permissions: []string{
+			PermissionAddressSearch,
+			PermissionAddressGeocode,
+			PermissionProfileRead,
+			PermissionTokensRevoke,
+			PermissionKeysManage,
+			PermissionUsersManage,
+			PermissionAuditRead,
+			PermissionTenantsManage,
+		},
+	},
+}
+
+type RoleRepository interface {
+	GetRole(ctx context.Context, name string) (*Role, error)
+	// EnsureRole creates the role if it does not exist and grants it the
+	// listed permissions it does not have yet.
+	EnsureRole(ctx context.Context, role *Role) error
+	UserRoles(ctx context.Context, userID int64) ([]string, error)
+	AssignRole(ctx context.Context, userID int64, role string) error
+	// SetUserRoles replaces all roles of the user. It returns ErrRoleNotFound
+	// without changing anything if one of the roles does not exist.
+	SetUserRoles(ctx context.Context, userID int64, roles []string) error
+}
+
+type MemoryRoleRepository struct {
+	mu        sync.RWMutex
+	roles     map[string]Role
+	userRoles map[int64]map[string]struct{}
+}
+
+func NewMemoryRoleRepository() *MemoryRoleRepository {
+	return &MemoryRoleRepository{
+		roles:     make(map[string]Role),
+		userRoles: make(map[int64]map[string]struct{}),
+	}
+}
+
+func (r *MemoryRoleRepository) GetRole(ctx context.Context, name string) (*Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	role, ok := r.roles[name]
+	if !ok {
+		return nil, ErrRoleNotFound
+	}
+	role.Permissions = append([]string(nil), role.Permissions...)
+	return &role, nil
+}
+
+func (r *MemoryRoleRepository) EnsureRole(ctx context.Context, role *Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := r.roles[role.Name]
+	stored.Name = role.Name
+	for _, permission := range role.Permissions {
+		if !containsString(stored.Permissions, permission) {
+			stored.Permissions = append(stored.Permissions, permission)
+		}
+	}
+	sort.Strings(stored.Permissions)
+	r.roles[role.Name] = stored
+	return nil
+}
+
+func containsString(items []string, item string) bool {
+	for _, s := range items {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MemoryRoleRepository) UserRoles(ctx context.Context, userID int64) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]string, 0, len(r.userRoles[userID]))
+	for role := range r.userRoles[userID] {
+		res = append(res, role)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (r *MemoryRoleRepository) AssignRole(ctx context.Context, userID int64, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.roles[role]; !ok {
+		return ErrRoleNotFound
+	}
+	if r.userRoles[userID] == nil {
+		r.userRoles[userID] = make(map[string]struct{})
+	}
+	r.userRoles[userID][role] = struct{}{}
+	return nil
+}
+
+func (r *MemoryRoleRepository) SetUserRoles(ctx context.Context, userID int64, roles []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	set := make(map[string]struct{}, len(roles))
+	for _, role := range roles {
+		if _, ok := r.roles[role]; !ok {
+			return ErrRoleNotFound
+		}
+		set[role] = struct{}{}
+	}
+	r.userRoles[userID] = set
+	return nil
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+
+	"test/internal/database"
+)
+
+var roleMigrations = []string{
+	`CREATE TABLE roles (
+		name TEXT PRIMARY KEY
+	)`,
+	`CREATE TABLE role_permissions (
+		role       TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+		permission TEXT NOT NULL,
+		PRIMARY KEY (role, permission)
+	)`,
+	`CREATE TABLE user_roles (
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		role    TEXT NOT NULL,
+		PRIMARY KEY (user_id, role)
+	)`,
+	// Users registered before roles existed keep their access.
+	`INSERT INTO user_roles (user_id, role) SELECT id, 'user' FROM users`,
+}
+
+type SQLiteRoleRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteRoleRepository must be created after the user repository because
+// user_roles references the users table.
+func NewSQLiteRoleRepository(db *sql.DB) (*SQLiteRoleRepository, error) {
+	if err := database.Migrate(db, "roles", roleMigrations); err != nil {
+		return nil, err
+	}
+	return &SQLiteRoleRepository{db: db}, nil
+}
+
+func (r *SQLiteRoleRepository) GetRole(ctx context.Context, name string) (*Role, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM roles WHERE name = ?)`, name).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrRoleNotFound
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT permission FROM role_permissions WHERE role = ? ORDER BY permission`, name,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	role := &Role{Name: name, Permissions: []string{}}
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		role.Permissions = append(role.Permissions, permission)
+	}
+	return role, rows.Err()
+}
+
+func (r *SQLiteRoleRepository) EnsureRole(ctx context.Context, role *Role) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO roles (name) VALUES (?) ON CONFLICT (name) DO NOTHING`, role.Name); err != nil {
+		return err
+	}
+	for _, permission := range role.Permissions {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO role_permissions (role, permission) VALUES (?, ?) ON CONFLICT DO NOTHING`, role.Name, permission,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteRoleRepository) UserRoles(ctx context.Context, userID int64) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT role FROM user_roles WHERE user_id = ? ORDER BY role`, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []string{}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		res = append(res, role)
+	}
+	return res, rows.Err()
+}
+
+func (r *SQLiteRoleRepository) AssignRole(ctx context.Context, userID int64, role string) error {
+	if _, err := r.GetRole(ctx, role); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO user_roles (user_id, role) VALUES (?, ?) ON CONFLICT DO NOTHING`, userID, role,
+	)
+	return err
+}
+
+func (r *SQLiteRoleRepository) SetUserRoles(ctx context.Context, userID int64, roles []string) error {
+	for _, role := range roles {
+		if _, err := r.GetRole(ctx, role); err != nil {
+			return err
+		}
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO user_roles (user_id, role) VALUES (?, ?) ON CONFLICT DO NOTHING`, userID, role,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
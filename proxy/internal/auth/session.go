@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"test/internal/responder"
+
+	"github.com/go-chi/jwtauth/v5"
+)
+
+const (
+	SessionCookie        = "session"
+	SessionRefreshCookie = "session_refresh"
+	// CSRFCookie is readable by scripts of the page, which send its value
+	// back in CSRFHeader with every state-changing request.
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+var ErrCSRFTokenInvalid = errors.New("csrf token is missing or does not match")
+
+type SessionConfig struct {
+	Secure     bool
+	SameSite   http.SameSite
+	RefreshTTL time.Duration
+}
+
+// Sessions keeps the tokens of browser clients in HttpOnly cookies, so
+// scripts of the page never see them. Requests authenticated by those
+// cookies are protected from CSRF with a double-submit token.
+type Sessions struct {
+	config SessionConfig
+}
+
+func NewSessions(config SessionConfig) *Sessions {
+	return &Sessions{
+		config: config,
+	}
+}
+
+// Start sets the cookies of a new or refreshed session.
+func (s *Sessions) Start(w http.ResponseWriter, tokens *TokenResponse) error {
+	csrf, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+
+	s.setCookie(w, SessionCookie, tokens.Token, "/", int(tokens.ExpiresIn), true)
+	s.setCookie(w, SessionRefreshCookie, tokens.RefreshToken, "/api", int(s.config.RefreshTTL.Seconds()), true)
+	s.setCookie(w, CSRFCookie, csrf, "/", int(s.config.RefreshTTL.Seconds()), false)
+	return nil
+}
+
+// End removes the session cookies.
+func (s *Sessions) End(w http.ResponseWriter) {
+	s.setCookie(w, SessionCookie, "", "/", -1, true)
+	s.setCookie(w, SessionRefreshCookie, "", "/api", -1, true)
+	s.setCookie(w, CSRFCookie, "", "/", -1, false)
+}
+
+func (s *Sessions) setCookie(w http.ResponseWriter, name, value, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   s.config.Secure,
+		SameSite: s.config.SameSite,
+	})
+}
+
+// TokenFromCookie returns the access token of the session, for use with
+// Verifier.
+func (s *Sessions) TokenFromCookie(r *http.Request) string {
+	return cookieValue(r, SessionCookie)
+}
+
+// RefreshTokenFromCookie returns the refresh token of the session.
+func (s *Sessions) RefreshTokenFromCookie(r *http.Request) string {
+	return cookieValue(r, SessionRefreshCookie)
+}
+
+// CSRF rejects state-changing requests that carry session cookies but no
+// matching CSRFHeader with 403. Requests with a bearer token or an API key
+// are not authenticated by cookies and are let through. Any other
+// Authorization header, e.g. Basic, does not stop the verifier from falling
+// back to the session cookie, so it is checked like a cookie-only request.
+func (s *Sessions) CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if jwtauth.TokenFromHeader(r) != "" || apiKeyFromRequest(r) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.TokenFromCookie(r) == "" && s.RefreshTokenFromCookie(r) == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		expected := cookieValue(r, CSRFCookie)
+		actual := r.Header.Get(CSRFHeader)
+		if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) != 1 {
+			responder.ErrorForbidden(w, ErrCSRFTokenInvalid)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func cookieValue(r *http.Request, name string) string {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	sessions := NewSessions(SessionConfig{})
+	handler := sessions.CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for name, tc := range map[string]struct {
+		header, value string
+		want          int
+	}{
+		"cookie only":      {want: http.StatusForbidden},
+		"matching header":  {header: CSRFHeader, value: "csrf", want: http.StatusNoContent},
+		"bearer token":     {header: "Authorization", value: "Bearer token", want: http.StatusNoContent},
+		"api key":          {header: "X-API-Key", value: "hp_key", want: http.StatusNoContent},
+		"api key scheme":   {header: "Authorization", value: "ApiKey hp_key", want: http.StatusNoContent},
+		"basic credential": {header: "Authorization", value: "Basic x", want: http.StatusForbidden},
+		"empty bearer":     {header: "Authorization", value: "Bearer ", want: http.StatusForbidden},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/me/password", nil)
+			r.AddCookie(&http.Cookie{Name: SessionCookie, Value: "session"})
+			r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: "csrf"})
+			if tc.header != "" {
+				r.Header.Set(tc.header, tc.value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tc.want {
+				t.Errorf("got %d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+}
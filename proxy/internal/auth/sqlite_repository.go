@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"test/internal/database"
+)
+
+var userMigrations = []string{
+	`CREATE TABLE users (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		username      TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		password_hash TEXT NOT NULL,
+		created_at    TIMESTAMP NOT NULL,
+		updated_at    TIMESTAMP NOT NULL
+	)`,
+	`ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP`,
+	`ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE users ADD COLUMN disabled_at TIMESTAMP`,
+	`ALTER TABLE users ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 0`,
+}
+
+const userColumns = `id, username, display_name, email, email_verified_at, password_hash, disabled_at, tenant_id, created_at, updated_at`
+
+type SQLiteUserRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteUserRepository(db *sql.DB) (*SQLiteUserRepository, error) {
+	if err := database.Migrate(db, "users", userMigrations); err != nil {
+		return nil, err
+	}
+	return &SQLiteUserRepository{db: db}, nil
+}
+
+func (r *SQLiteUserRepository) Create(ctx context.Context, user *User) error {
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO users (username, display_name, email, email_verified_at, password_hash, disabled_at, tenant_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.Username, user.DisplayName, user.Email, user.EmailVerifiedAt, user.PasswordHash, user.DisabledAt, user.TenantID, now, now,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrUserExists
+		}
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	user.ID = id
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	return nil
+}
+
+func (r *SQLiteUserRepository) GetByID(ctx context.Context, id int64) (*User, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+	return scanUser(row)
+}
+
+func (r *SQLiteUserRepository) GetByUsername(ctx context.Context, username string) (*User, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE username = ?`, username)
+	return scanUser(row)
+}
+
+func (r *SQLiteUserRepository) Update(ctx context.Context, user *User) error {
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE users SET username = ?, display_name = ?, email = ?, email_verified_at = ?, password_hash = ?, disabled_at = ?, tenant_id = ?, updated_at = ? WHERE id = ?`,
+		user.Username, user.DisplayName, user.Email, user.EmailVerifiedAt, user.PasswordHash, user.DisabledAt, user.TenantID, now, user.ID,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrUserExists
+		}
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	user.UpdatedAt = now
+	return nil
+}
+
+func (r *SQLiteUserRepository) List(ctx context.Context, filter UserFilter) ([]*User, int, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Query != "" {
+		pattern := "%" + likeEscaper.Replace(filter.Query) + "%"
+		conditions = append(conditions, `(username LIKE ? ESCAPE '\' OR display_name LIKE ? ESCAPE '\' OR email LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern, pattern)
+	}
+	if filter.TenantID != 0 {
+		conditions = append(conditions, `tenant_id = ?`)
+		args = append(args, filter.TenantID)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+userColumns+` FROM users`+where+` ORDER BY id LIMIT ? OFFSET ?`,
+		append(args, filter.Limit, filter.Offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+// likeEscaper makes % and _ in a search query match literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (r *SQLiteUserRepository) Delete(ctx context.Context, id int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row rowScanner) (*User, error) {
+	var user User
+	var emailVerifiedAt, disabledAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Username, &user.DisplayName, &user.Email, &emailVerifiedAt, &user.PasswordHash, &disabledAt, &user.TenantID, &user.CreatedAt, &user.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
+	if disabledAt.Valid {
+		user.DisabledAt = &disabledAt.Time
+	}
+	return &user, nil
+}
+
+func isUniqueViolation(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
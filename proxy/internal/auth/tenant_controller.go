@@ -0,0 +1,414 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"test/internal/audit"
+	"test/internal/responder"
+	"test/internal/tenant"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type TenantController struct {
+	tenants tenant.Repository
+	users   UserRepository
+	tokens  *TokenService
+	roles   *RoleService
+	mfa     *MFAService
+	limiter *tenant.Limiter
+	geo     *tenant.GeoServices
+	audit   audit.Logger
+}
+
+func NewTenantController(tenants tenant.Repository, users UserRepository, tokens *TokenService, roles *RoleService, mfa *MFAService, limiter *tenant.Limiter, geo *tenant.GeoServices, auditLog audit.Logger) *TenantController {
+	return &TenantController{
+		tenants: tenants,
+		users:   users,
+		tokens:  tokens,
+		roles:   roles,
+		mfa:     mfa,
+		limiter: limiter,
+		geo:     geo,
+		audit:   auditLog,
+	}
+}
+
+// List godoc
+// @Summary Список организаций
+// @Description Возвращает организации с их лимитами и использованием за текущие сутки (UTC). Ключи DaData не возвращаются
+// @Tags tenants
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} TenantResponse "Организации"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/tenants [get]
+func (c *TenantController) List() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenants, err := c.tenants.List(r.Context())
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		res := make([]TenantResponse, 0, len(tenants))
+		for _, t := range tenants {
+			item, err := c.tenantResponse(r.Context(), t)
+			if err != nil {
+				responder.ErrorInternal(w, err)
+				return
+			}
+			res = append(res, item)
+		}
+		responder.OutputJSON(w, res)
+	}
+}
+
+// Create godoc
+// @Summary Создание организации
+// @Description Создает организацию. Нулевые лимиты означают отсутствие ограничений, пустые ключи DaData — использование ключей сервиса
+// @Tags tenants
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body TenantRequest true "Организация"
+// @Success 201 {object} TenantResponse "Организация создана"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 409 {object} ErrorResponse "Организация с таким названием уже существует"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/tenants [post]
+func (c *TenantController) Create() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data TenantRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+		if data.Name == nil {
+			responder.ErrorBadRequest(w, errors.New("name is required"))
+			return
+		}
+
+		var t tenant.Tenant
+		if err := applyTenantRequest(&t, data); err != nil {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+		err := c.tenants.Create(r.Context(), &t)
+		if errors.Is(err, tenant.ErrTenantExists) {
+			responder.ErrorConflict(w, err)
+			return
+		}
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		c.record(r, audit.EventTenantCreate, &t)
+
+		res, err := c.tenantResponse(r.Context(), &t)
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		responder.OutputJSON(w, res)
+	}
+}
+
+// Get godoc
+// @Summary Организация
+// @Description Возвращает организацию с ее лимитами и использованием за текущие сутки (UTC)
+// @Tags tenants
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID организации"
+// @Success 200 {object} TenantResponse "Организация"
+// @Failure 400 {object} ErrorResponse "Некорректный ID"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 404 {object} ErrorResponse "Организация не найдена"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/tenants/{id} [get]
+func (c *TenantController) Get() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := c.tenantFromPath(w, r)
+		if !ok {
+			return
+		}
+		c.outputTenant(w, r, t)
+	}
+}
+
+// Update godoc
+// @Summary Изменение организации
+// @Description Меняет только переданные поля. Пустые ключи DaData возвращают организацию к ключам сервиса
+// @Tags tenants
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID организации"
+// @Param request body TenantRequest true "Изменяемые поля"
+// @Success 200 {object} TenantResponse "Организация изменена"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 404 {object} ErrorResponse "Организация не найдена"
+// @Failure 409 {object} ErrorResponse "Организация с таким названием уже существует"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/tenants/{id} [patch]
+func (c *TenantController) Update() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := c.tenantFromPath(w, r)
+		if !ok {
+			return
+		}
+		var data TenantRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+		if err := applyTenantRequest(t, data); err != nil {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+
+		err := c.tenants.Update(r.Context(), t)
+		if errors.Is(err, tenant.ErrTenantExists) {
+			responder.ErrorConflict(w, err)
+			return
+		}
+		if errors.Is(err, tenant.ErrTenantNotFound) {
+			responder.ErrorNotFound(w, err)
+			return
+		}
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		c.geo.Forget(t.ID)
+		c.record(r, audit.EventTenantUpdate, t)
+
+		c.outputTenant(w, r, t)
+	}
+}
+
+// Delete godoc
+// @Summary Удаление организации
+// @Description Удаляет организацию. Организацию с пользователями удалить нельзя, сначала их нужно перевести в другую организацию или убрать из нее
+// @Tags tenants
+// @Security BearerAuth
+// @Param id path int true "ID организации"
+// @Success 204 "Организация удалена"
+// @Failure 400 {object} ErrorResponse "Некорректный ID"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 404 {object} ErrorResponse "Организация не найдена"
+// @Failure 409 {object} ErrorResponse "В организации есть пользователи"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/tenants/{id} [delete]
+func (c *TenantController) Delete() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := c.tenantFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		members, err := c.countUsers(r.Context(), t.ID)
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		if members > 0 {
+			responder.ErrorConflict(w, errors.New("tenant still has users"))
+			return
+		}
+
+		err = c.tenants.Delete(r.Context(), t.ID)
+		if errors.Is(err, tenant.ErrTenantNotFound) {
+			responder.ErrorNotFound(w, err)
+			return
+		}
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		c.limiter.Forget(t.ID)
+		c.geo.Forget(t.ID)
+		c.record(r, audit.EventTenantDelete, t)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// SetUserTenant godoc
+// @Summary Организация пользователя
+// @Description Переводит пользователя в организацию, tenant_id 0 убирает его из организации. Организация передается в токенах, поэтому все токены пользователя отзываются
+// @Tags tenants
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param request body SetTenantRequest true "Организация"
+// @Success 200 {object} AdminUserResponse "Пользователь"
+// @Failure 400 {object} ErrorResponse "Некорректный запрос или организация не найдена"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 403 {object} ErrorResponse "Недостаточно прав"
+// @Failure 404 {object} ErrorResponse "Пользователь не найден"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/tenant [put]
+func (c *TenantController) SetUserTenant() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data SetTenantRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+		user, ok := userFromPath(w, r, c.users)
+		if !ok {
+			return
+		}
+
+		if data.TenantID != 0 {
+			_, err := c.tenants.Get(r.Context(), data.TenantID)
+			if errors.Is(err, tenant.ErrTenantNotFound) {
+				responder.ErrorBadRequest(w, err)
+				return
+			}
+			if err != nil {
+				responder.ErrorInternal(w, err)
+				return
+			}
+		}
+
+		if user.TenantID != data.TenantID {
+			before := user.TenantID
+			user.TenantID = data.TenantID
+			if err := c.users.Update(r.Context(), user); err != nil {
+				responder.ErrorInternal(w, err)
+				return
+			}
+			// Tokens carry the tenant, so the old ones would keep using the
+			// limits and credentials of the previous tenant.
+			if err := c.tokens.RevokeAllForUser(r.Context(), user.ID); err != nil {
+				responder.ErrorInternal(w, err)
+				return
+			}
+			recordAdminAction(r, c.audit, audit.EventUserTenant, user, map[string]string{
+				"before": strconv.FormatInt(before, 10),
+				"after":  strconv.FormatInt(data.TenantID, 10),
+			})
+		}
+
+		outputAdminUser(w, r, c.roles, c.mfa, user)
+	}
+}
+
+func applyTenantRequest(t *tenant.Tenant, data TenantRequest) error {
+	if data.Name != nil {
+		name := strings.TrimSpace(*data.Name)
+		if name == "" {
+			return errors.New("name must not be empty")
+		}
+		t.Name = name
+	}
+	if data.DaDataAPIKey != nil {
+		t.DaDataAPIKey = strings.TrimSpace(*data.DaDataAPIKey)
+	}
+	if data.DaDataSecretKey != nil {
+		t.DaDataSecretKey = strings.TrimSpace(*data.DaDataSecretKey)
+	}
+	if (t.DaDataAPIKey == "") != (t.DaDataSecretKey == "") {
+		return errors.New("dadata_api_key and dadata_secret_key must be set together")
+	}
+	if data.RateLimit != nil {
+		if *data.RateLimit < 0 {
+			return errors.New("rate_limit must not be negative")
+		}
+		t.RateLimit = *data.RateLimit
+	}
+	if data.DailyQuota != nil {
+		if *data.DailyQuota < 0 {
+			return errors.New("daily_quota must not be negative")
+		}
+		t.DailyQuota = *data.DailyQuota
+	}
+	return nil
+}
+
+func (c *TenantController) tenantFromPath(w http.ResponseWriter, r *http.Request) (*tenant.Tenant, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		responder.ErrorBadRequest(w, errors.New("invalid tenant id"))
+		return nil, false
+	}
+
+	t, err := c.tenants.Get(r.Context(), id)
+	if errors.Is(err, tenant.ErrTenantNotFound) {
+		responder.ErrorNotFound(w, err)
+		return nil, false
+	}
+	if err != nil {
+		responder.ErrorInternal(w, err)
+		return nil, false
+	}
+	return t, true
+}
+
+func (c *TenantController) countUsers(ctx context.Context, tenantID int64) (int, error) {
+	_, total, err := c.users.List(ctx, UserFilter{TenantID: tenantID, Limit: 1})
+	return total, err
+}
+
+// record writes a change of the tenant to the audit log, noting the admin in
+// the "by" detail.
+func (c *TenantController) record(r *http.Request, eventType string, t *tenant.Tenant) {
+	claims, _ := ClaimsFromContext(r.Context())
+	recordAudit(r.Context(), c.audit, audit.Event{
+		Type:     eventType,
+		TenantID: t.ID,
+		Details:  map[string]string{"name": t.Name, "by": claims.Username},
+	})
+}
+
+func (c *TenantController) outputTenant(w http.ResponseWriter, r *http.Request, t *tenant.Tenant) {
+	res, err := c.tenantResponse(r.Context(), t)
+	if err != nil {
+		responder.ErrorInternal(w, err)
+		return
+	}
+	responder.OutputJSON(w, res)
+}
+
+func (c *TenantController) tenantResponse(ctx context.Context, t *tenant.Tenant) (TenantResponse, error) {
+	members, err := c.countUsers(ctx, t.ID)
+	if err != nil {
+		return TenantResponse{}, err
+	}
+	return TenantResponse{
+		ID:                t.ID,
+		Name:              t.Name,
+		HasGeoCredentials: t.HasGeoCredentials(),
+		RateLimit:         t.RateLimit,
+		DailyQuota:        t.DailyQuota,
+		Users:             members,
+		Usage:             c.limiter.Usage(t, time.Now()),
+		CreatedAt:         t.CreatedAt,
+		UpdatedAt:         t.UpdatedAt,
+	}, nil
+}
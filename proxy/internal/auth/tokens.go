@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"test/internal/audit"
+
+	"github.com/go-chi/jwtauth/v5"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, all sessions of this login were revoked")
+)
+
+// TokenService issues short-lived JWT access tokens together with opaque
+// refresh tokens and rotates the latter on every use.
+type TokenService struct {
+	codec    TokenCodec
+	refresh  RefreshTokenRepository
+	users    UserRepository
+	roles    *RoleService
+	denylist *Denylist
+	// credentials are the API keys and personal access tokens, revoked by
+	// RevokeEverything.
+	credentials []CredentialRepository
+	audit       audit.Logger
+	config      TokenConfig
+}
+
+type TokenConfig struct {
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	Issuer     string
+	Audience   string
+}
+
+func NewTokenService(codec TokenCodec, refresh RefreshTokenRepository, users UserRepository, roles *RoleService, denylist *Denylist, credentials []CredentialRepository, auditLog audit.Logger, config TokenConfig) *TokenService {
+	return &TokenService{
+		codec:       codec,
+		refresh:     refresh,
+		users:       users,
+		roles:       roles,
+		denylist:    denylist,
+		credentials: credentials,
+		audit:       auditLog,
+		config:      config,
+	}
+}
+
+// Issue starts a new refresh token family for the user.
+func (s *TokenService) Issue(ctx context.Context, user *User) (*TokenResponse, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(ctx, user, familyID)
+}
+
+// Refresh exchanges a refresh token for a new token pair. Every refresh token
+// is single use: presenting one that was already exchanged is treated as theft
+// and revokes every token of its family.
+func (s *TokenService) Refresh(ctx context.Context, rawToken string) (*TokenResponse, error) {
+	stored, err := s.refresh.GetByHash(ctx, hashToken(rawToken))
+	if errors.Is(err, ErrRefreshTokenNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if stored.RevokedAt != nil || now.After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if stored.UsedAt != nil {
+		return nil, s.revokeReused(ctx, stored, now)
+	}
+	if err := s.refresh.MarkUsed(ctx, stored.ID, now); err != nil {
+		if errors.Is(err, ErrRefreshTokenUsed) {
+			return nil, s.revokeReused(ctx, stored, now)
+		}
+		return nil, err
+	}
+
+	user, err := s.users.GetByID(ctx, stored.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrUserDisabled
+	}
+
+	tokens, err := s.issue(ctx, user, stored.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	recordAudit(ctx, s.audit, userEvent(audit.EventTokenRefresh, user, map[string]string{"family": stored.FamilyID}))
+	return tokens, nil
+}
+
+// Logout revokes the access token identified by jti and, when given, the
+// refresh token family of the same session.
+func (s *TokenService) Logout(ctx context.Context, userID int64, jti string, expiresAt time.Time, rawRefresh string) error {
+	if err := s.denylist.RevokeToken(ctx, jti, expiresAt); err != nil {
+		return err
+	}
+	recordAudit(ctx, s.audit, audit.Event{
+		Type:    audit.EventTokenRevoke,
+		UserID:  userID,
+		Details: map[string]string{"scope": "session", "jti": jti},
+	})
+	if rawRefresh == "" {
+		return nil
+	}
+
+	stored, err := s.refresh.GetByHash(ctx, hashToken(rawRefresh))
+	if errors.Is(err, ErrRefreshTokenNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if stored.UserID != userID {
+		return nil
+	}
+	return s.refresh.RevokeFamily(ctx, stored.FamilyID, time.Now().UTC())
+}
+
+// RevokeAllForUser invalidates every access and refresh token issued to the
+// user so far, e.g. because the roles or the tenant they carry changed. API
+// keys and personal access tokens keep working: they resolve the roles and
+// the tenant of their owner on every request.
+func (s *TokenService) RevokeAllForUser(ctx context.Context, userID int64) error {
+	return s.revokeAll(ctx, userID, false)
+}
+
+// RevokeEverything invalidates every access and refresh token of the user
+// and revokes the user's API keys and personal access tokens as well. It is
+// used whenever the account may be compromised, e.g. on a password change.
+func (s *TokenService) RevokeEverything(ctx context.Context, userID int64) error {
+	return s.revokeAll(ctx, userID, true)
+}
+
+func (s *TokenService) revokeAll(ctx context.Context, userID int64, credentials bool) error {
+	now := time.Now().UTC()
+	if err := s.denylist.RevokeUser(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.refresh.RevokeUser(ctx, userID, now); err != nil {
+		return err
+	}
+	scope := "all"
+	if credentials {
+		for _, repo := range s.credentials {
+			if err := repo.RevokeUser(ctx, userID, now); err != nil {
+				return err
+			}
+		}
+		scope = "all_with_credentials"
+	}
+	recordAudit(ctx, s.audit, audit.Event{
+		Type:    audit.EventTokenRevoke,
+		UserID:  userID,
+		Details: map[string]string{"scope": scope},
+	})
+	return nil
+}
+
+// RevokeAllAndIssue revokes every token and credential of the user and
+// issues a new pair for the session that asked for it.
+func (s *TokenService) RevokeAllAndIssue(ctx context.Context, user *User) (*TokenResponse, error) {
+	if err := s.RevokeEverything(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	return s.Issue(ctx, user)
+}
+
+func (s *TokenService) revokeReused(ctx context.Context, stored *RefreshToken, now time.Time) error {
+	log.Printf("refresh token reuse detected for user %d, revoking family %s", stored.UserID, stored.FamilyID)
+	if err := s.refresh.RevokeFamily(ctx, stored.FamilyID, now); err != nil {
+		return err
+	}
+	recordAudit(ctx, s.audit, audit.Event{
+		Type:    audit.EventTokenReuse,
+		UserID:  stored.UserID,
+		Details: map[string]string{"family": stored.FamilyID},
+	})
+	return ErrRefreshTokenReused
+}
+
+func (s *TokenService) issue(ctx context.Context, user *User, familyID string) (*TokenResponse, error) {
+	now := s.denylist.IssueTime(user.ID)
+	accessClaims := userClaims(user)
+	roles, permissions, err := s.roles.Resolve(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	accessClaims[ClaimRoles] = roles
+	accessClaims[ClaimPermissions] = permissions
+	jti, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	accessClaims["jti"] = jti
+	accessClaims["iss"] = s.config.Issuer
+	accessClaims["aud"] = s.config.Audience
+	jwtauth.SetIssuedAt(accessClaims, now)
+	accessClaims[ClaimIssuedAtMicros] = now.UnixMicro()
+	accessClaims["nbf"] = now.Unix()
+	jwtauth.SetExpiry(accessClaims, now.Add(s.config.AccessTTL))
+
+	_, accessToken, err := s.codec.Encode(accessClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	rawRefresh, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	err = s.refresh.Create(ctx, &RefreshToken{
+		TokenHash: hashToken(rawRefresh),
+		FamilyID:  familyID,
+		UserID:    user.ID,
+		ExpiresAt: now.Add(s.config.RefreshTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		Token:        accessToken,
+		RefreshToken: rawRefresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.config.AccessTTL.Seconds()),
+	}, nil
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
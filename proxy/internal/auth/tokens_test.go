@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type tokenTestEnv struct {
+	codec    *KeyRing
+	denylist *Denylist
+	tokens   *TokenService
+	user     *User
+}
+
+func newTokenTestEnv(t *testing.T) *tokenTestEnv {
+	t.Helper()
+	ctx := context.Background()
+	key, err := newHMACKey([]byte("0123456789abcdef0123456789abcdef"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec, err := NewStaticKeyRing(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := NewMemoryUserRepository()
+	user := &User{Username: "alice"}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	roles := NewRoleService(NewMemoryRoleRepository(), users, nil)
+	if err := roles.Seed(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := roles.AssignDefaults(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	denylist := NewDenylist(nil, 15*time.Minute)
+	return &tokenTestEnv{
+		codec:    codec,
+		denylist: denylist,
+		tokens: NewTokenService(codec, NewMemoryRefreshTokenRepository(), users, roles, denylist, nil, nil, TokenConfig{
+			AccessTTL:  15 * time.Minute,
+			RefreshTTL: time.Hour,
+			Issuer:     "hugoproxy",
+			Audience:   "hugoproxy-api",
+		}),
+		user: user,
+	}
+}
+
+func (env *tokenTestEnv) revoked(t *testing.T, raw string) bool {
+	t.Helper()
+	token, err := env.codec.Decode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := ClaimsFromToken(token)
+	return env.denylist.IsRevoked(claims.TokenID, claims.UserID(), claims.IssuedAt)
+}
+
+func TestRevokeAllAndIssueIssuesImmediately(t *testing.T) {
+	env := newTokenTestEnv(t)
+	ctx := context.Background()
+
+	old, err := env.tokens.Issue(ctx, env.user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		start := time.Now()
+		fresh, err := env.tokens.RevokeAllAndIssue(ctx, env.user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Fatalf("took %v", elapsed)
+		}
+		if !env.revoked(t, old.Token) {
+			t.Fatal("token issued before the revocation is still accepted")
+		}
+		if env.revoked(t, fresh.Token) {
+			t.Fatalf("token issued right after the revocation is rejected (attempt %d)", i)
+		}
+		old = fresh
+	}
+}
+
+func TestUserRevocationCoversSecondPrecisionTokens(t *testing.T) {
+	env := newTokenTestEnv(t)
+	if err := env.denylist.RevokeUser(context.Background(), env.user.ID); err != nil {
+		t.Fatal(err)
+	}
+	// A token without iat_us issued in the same second as the revocation
+	// may predate it.
+	issuedAt := time.Now().UTC().Truncate(time.Second)
+	if !env.denylist.IsRevoked("jti", env.user.ID, issuedAt) {
+		t.Error("token with a whole second iat is accepted")
+	}
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("user already exists")
+	ErrUserDisabled = errors.New("account is disabled")
+)
+
+type User struct {
+	ID              int64
+	Username        string
+	DisplayName     string
+	Email           string
+	EmailVerifiedAt *time.Time // set once the user confirmed Email
+	PasswordHash    string
+	DisabledAt      *time.Time // set while an admin disabled the account
+	TenantID        int64      // zero for users outside of any tenant
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// UserRepository stores registered users. Usernames are unique and compared
+// case-insensitively.
+type UserRepository interface {
+	Create(ctx context.Context, user *User) error
+	GetByID(ctx context.Context, id int64) (*User, error)
+	GetByUsername(ctx context.Context, username string) (*User, error)
+	Update(ctx context.Context, user *User) error
+	// List returns a page of users ordered by ID together with the number of
+	// users matching the filter.
+	List(ctx context.Context, filter UserFilter) ([]*User, int, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+// UserFilter selects users for List. Query matches a part of the username,
+// display name or email, case-insensitively. TenantID, if set, only selects
+// users of that tenant.
+type UserFilter struct {
+	Query    string
+	TenantID int64
+	Limit    int
+	Offset   int
+}
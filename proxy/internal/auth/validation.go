@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"bufio"
+	"net/mail"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{2,31}$`)
+
+// bcrypt ignores everything past 72 bytes, so longer passwords are rejected
+// instead of being silently truncated.
+const maxPasswordBytes = 72
+
+// ValidationErrors maps a request field to the reason it was rejected.
+type ValidationErrors map[string]string
+
+func (v ValidationErrors) Error() string {
+	fields := make([]string, 0, len(v))
+	for field := range v {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, field+": "+v[field])
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	breached      map[string]struct{}
+}
+
+// LoadBreachedPasswords reads a newline separated list of known leaked
+// passwords into the policy. Empty lines and lines starting with # are skipped.
+func (p *PasswordPolicy) LoadBreachedPasswords(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	breached := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		breached[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	p.breached = breached
+	return nil
+}
+
+// Validate returns a human readable reason when the password does not satisfy
+// the policy, or an empty string when it does.
+func (p *PasswordPolicy) Validate(password, username string) string {
+	if len([]rune(password)) < p.MinLength {
+		return "must be at least " + strconv.Itoa(p.MinLength) + " characters long"
+	}
+	if len(password) > maxPasswordBytes {
+		return "must be at most " + strconv.Itoa(maxPasswordBytes) + " bytes long"
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	var missing []string
+	if p.RequireUpper && !hasUpper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		missing = append(missing, "a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		missing = append(missing, "a special character")
+	}
+	if len(missing) > 0 {
+		return "must contain " + strings.Join(missing, ", ")
+	}
+
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return "must not contain the username"
+	}
+	if _, ok := p.breached[strings.ToLower(password)]; ok {
+		return "has appeared in a data breach, choose a different one"
+	}
+
+	return ""
+}
+
+// ValidateUsername accepts either a login (3-32 letters, digits, dots,
+// dashes and underscores) or an email address.
+func ValidateUsername(username string) string {
+	if username == "" {
+		return "is required"
+	}
+	if strings.Contains(username, "@") {
+		return ValidateEmail(username)
+	}
+	if !usernamePattern.MatchString(username) {
+		return "must be 3-32 characters of letters, digits, '.', '_' or '-' and start with a letter or digit"
+	}
+	return ""
+}
+
+func ValidateEmail(email string) string {
+	if len(email) > 254 {
+		return "is too long"
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+const maxDisplayNameLength = 64
+
+// ValidateDisplayName accepts up to 64 printable characters. An empty name
+// clears it.
+func ValidateDisplayName(name string) string {
+	if utf8.RuneCountInString(name) > maxDisplayNameLength {
+		return "must be at most " + strconv.Itoa(maxDisplayNameLength) + " characters"
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return "must not contain control characters"
+		}
+	}
+	return ""
+}
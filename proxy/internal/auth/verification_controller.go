@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"test/internal/responder"
+)
+
+type VerificationController struct {
+	verification *EmailVerificationService
+}
+
+func NewVerificationController(verification *EmailVerificationService) *VerificationController {
+	return &VerificationController{
+		verification: verification,
+	}
+}
+
+// Verify godoc
+// @Summary Подтверждение email
+// @Description Подтверждает адрес электронной почты по ссылке из письма
+// @Tags auth
+// @Produce json
+// @Param token query string true "Токен из ссылки"
+// @Success 200 {object} UserProfile "Email подтвержден"
+// @Failure 400 {object} ErrorResponse "Ссылка недействительна или истекла"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /email/verify [get]
+func (c *VerificationController) Verify() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			responder.ErrorBadRequest(w, errors.New("token is required"))
+			return
+		}
+
+		user, err := c.verification.Verify(r.Context(), token)
+		if errors.Is(err, ErrInvalidVerificationToken) {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+
+		responder.OutputJSON(w, NewUserProfile(user))
+	}
+}
+
+// Resend godoc
+// @Summary Повторная отправка письма подтверждения
+// @Description Отправляет новую ссылку для подтверждения email текущего пользователя. Не чаще одного раза за EMAIL_VERIFICATION_RESEND_INTERVAL
+// @Tags auth
+// @Security BearerAuth
+// @Success 202 "Письмо отправлено"
+// @Failure 400 {object} ErrorResponse "Email уже подтвержден или не указан"
+// @Failure 401 {object} ErrorResponse "Токен отсутствует или недействителен"
+// @Failure 429 {object} ErrorResponse "Письмо уже отправлялось недавно, время ожидания в заголовке Retry-After"
+// @Failure 500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router /email/verify/resend [post]
+func (c *VerificationController) Resend() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := ClaimsFromContext(r.Context())
+		wait, err := c.verification.Resend(r.Context(), claims.UserID())
+		if errors.Is(err, ErrEmailAlreadyVerified) || errors.Is(err, ErrEmailMissing) {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
+		if errors.Is(err, ErrUserNotFound) {
+			responder.ErrorUnauthorized(w, err)
+			return
+		}
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		if wait > 0 {
+			responder.ErrorTooManyRequests(w, errors.New("verification email was sent recently"), wait)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -2,23 +2,41 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"test/internal/auth"
 	"test/internal/responder"
-
-	"github.com/go-chi/jwtauth/v5"
+	"test/internal/service"
+	"test/internal/tenant"
 )
 
 type GeoController struct {
-	GeoService GeoServiceInterface
-	TokenAuth  *jwtauth.JWTAuth
+	Provider service.GeoProvider
+	// Tenants holds the providers of tenants with their own credentials.
+	Tenants *tenant.GeoServices
 }
 
-func NewGeoController(geoService GeoServiceInterface, tokenAuth *jwtauth.JWTAuth) *GeoController {
+func NewGeoController(provider service.GeoProvider, tenants *tenant.GeoServices) *GeoController {
 	return &GeoController{
-		GeoService: geoService,
-		TokenAuth:  tokenAuth,
+		Provider: provider,
+		Tenants:  tenants,
+	}
+}
+
+// provider returns the geo provider of the tenant the request is made for,
+// or the default one.
+func (c *GeoController) provider(r *http.Request) (service.GeoProvider, error) {
+	if t, ok := tenant.FromContext(r.Context()); ok && c.Tenants != nil {
+		p, err := c.Tenants.For(t)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			return p, nil
+		}
 	}
+	return c.Provider, nil
 }
 
 // HandlerAddressSearch handles address search requests
@@ -28,10 +46,12 @@ func NewGeoController(geoService GeoServiceInterface, tokenAuth *jwtauth.JWTAuth
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param request body RequestAddressSearch true "Search query"
 // @Success 200 {object} ResponseAddress
 // @Failure 400 {string} string "Bad request"
 // @Failure 401 {string} string "Unauthorized"
+// @Failure 429 {string} string "Tenant rate limit or daily quota exceeded"
 // @Failure 500 {string} string "Internal server error"
 // @Router /address/search [post]
 func (c *GeoController) HandlerAddressSearch() http.HandlerFunc {
@@ -42,9 +62,15 @@ func (c *GeoController) HandlerAddressSearch() http.HandlerFunc {
 			return
 		}
 
-		_, claims, _ := jwtauth.FromContext(r.Context())
-		log.Println("Authenticated user:", claims["email"])
-		addresses, err := c.GeoService.AddressSearch(req.Query)
+		if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+			log.Println("Authenticated user:", claims.Username)
+		}
+		provider, err := c.provider(r)
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		addresses, err := provider.AddressSearch(r.Context(), req.Query)
 		if err != nil {
 			responder.ErrorInternal(w, err)
 			return
@@ -62,10 +88,12 @@ func (c *GeoController) HandlerAddressSearch() http.HandlerFunc {
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param request body RequestAddressGeocode true "Coordinates"
 // @Success 200 {object} ResponseAddress
 // @Failure 400 {string} string "Bad request"
 // @Failure 401 {string} string "Unauthorized"
+// @Failure 429 {string} string "Tenant rate limit or daily quota exceeded"
 // @Failure 500 {string} string "Internal server error"
 // @Router /address/geocode [post]
 func (c *GeoController) HandlerAddressGeocode() http.HandlerFunc {
@@ -76,9 +104,19 @@ func (c *GeoController) HandlerAddressGeocode() http.HandlerFunc {
 			return
 		}
 
-		_, claims, _ := jwtauth.FromContext(r.Context())
-		log.Println("Authenticated user:", claims["email"])
-		addresses, err := c.GeoService.GeoCode(req.Lat, req.Lng)
+		if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+			log.Println("Authenticated user:", claims.Username)
+		}
+		provider, err := c.provider(r)
+		if err != nil {
+			responder.ErrorInternal(w, err)
+			return
+		}
+		addresses, err := provider.GeoCode(r.Context(), req.Lat, req.Lng)
+		if errors.Is(err, service.ErrInvalidCoordinates) {
+			responder.ErrorBadRequest(w, err)
+			return
+		}
 		if err != nil {
 			responder.ErrorInternal(w, err)
 			return
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"test/internal/service"
+)
+
+func TestHandlerAddressGeocodeRejectsInvalidCoordinates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "addresses.json")
+	addresses := `[{"city": "Москва", "street": "Тверская", "house": "1", "lat": "55.757", "lon": "37.615"}]`
+	if err := os.WriteFile(path, []byte(addresses), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := service.NewStaticProvider(service.Settings{"file": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewGeoController(provider, nil).HandlerAddressGeocode()
+
+	for body, want := range map[string]int{
+		`{"lat": "55.75", "lng": "37.61"}`: http.StatusOK,
+		`{"lat": "north", "lng": "37.61"}`: http.StatusBadRequest,
+		`{"lat": "55.75", "lng": ""}`:      http.StatusBadRequest,
+		`{"lat": "91", "lng": "37.61"}`:    http.StatusBadRequest,
+		`{"lat": "55.75", "lng": "NaN"}`:   http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/address/geocode", strings.NewReader(body)))
+		if w.Code != want {
+			t.Errorf("%s: got %d, want %d", body, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+// OpenSQLite opens (and creates if needed) the SQLite database at path.
+func OpenSQLite(path string) (*sql.DB, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, so serialize access through one connection.
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		component TEXT NOT NULL,
+		version   INTEGER NOT NULL,
+		PRIMARY KEY (component, version)
+	)`); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Migrate applies the not yet applied steps of a component's schema in order.
+// Steps are identified by their index, so existing steps must never be edited,
+// only new ones appended.
+func Migrate(db *sql.DB, component string, steps []string) error {
+	var applied int
+	err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE component = ?`, component).Scan(&applied)
+	if err != nil {
+		return err
+	}
+
+	for version := applied; version < len(steps); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(steps[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate %s to version %d: %w", component, version+1, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (component, version) VALUES (?, ?)`, component, version+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
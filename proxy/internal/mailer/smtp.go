@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer sends messages through an SMTP relay. STARTTLS is used when the
+// server offers it; credentials are only sent over TLS or to localhost, as
+// enforced by net/smtp.
+type SMTPMailer struct {
+	config SMTPConfig
+}
+
+func NewSMTPMailer(config SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{config: config}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return errors.New("mail header must not contain line breaks")
+	}
+
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+	}
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, m.config.From, []string{msg.To}, compose(m.config.From, msg))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 //go:generate easytags $GOFILE
@@ -21,6 +24,10 @@ type Responder interface {
 	ErrorUnauthorized(w http.ResponseWriter, err error)
 	ErrorBadRequest(w http.ResponseWriter, err error)
 	ErrorForbidden(w http.ResponseWriter, err error)
+	ErrorNotFound(w http.ResponseWriter, err error)
+	ErrorConflict(w http.ResponseWriter, err error)
+	ErrorValidation(w http.ResponseWriter, err error, fields map[string]string)
+	ErrorTooManyRequests(w http.ResponseWriter, err error, retryAfter time.Duration)
 	ErrorInternal(w http.ResponseWriter, err error)
 }
 
@@ -73,6 +80,70 @@ func ErrorUnauthorized(w http.ResponseWriter, err error) {
 	}
 }
 
+func ErrorNotFound(w http.ResponseWriter, err error) {
+	log.Println("http response not found:", err)
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	var resp = Response{
+		Success: false,
+		Message: err.Error(),
+		Data:    nil,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Println("response writer error on write:", err)
+	}
+}
+
+func ErrorConflict(w http.ResponseWriter, err error) {
+	log.Println("http response conflict:", err)
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(http.StatusConflict)
+	var resp = Response{
+		Success: false,
+		Message: err.Error(),
+		Data:    nil,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Println("response writer error on write:", err)
+	}
+}
+
+// ErrorValidation responds with 400 and the per-field reasons in Data.
+func ErrorValidation(w http.ResponseWriter, err error, fields map[string]string) {
+	log.Println("http response validation error:", err)
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(http.StatusBadRequest)
+	var resp = Response{
+		Success: false,
+		Message: "validation failed",
+		Data:    fields,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Println("response writer error on write:", err)
+	}
+}
+
+// ErrorTooManyRequests responds with 429 and tells the client in Retry-After
+// how many seconds to wait.
+func ErrorTooManyRequests(w http.ResponseWriter, err error, retryAfter time.Duration) {
+	log.Println("http response too many requests:", err)
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(http.StatusTooManyRequests)
+	var resp = Response{
+		Success: false,
+		Message: err.Error(),
+		Data:    nil,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Println("response writer error on write:", err)
+	}
+}
+
 func ErrorInternal(w http.ResponseWriter, err error) {
 	if errors.Is(err, context.Canceled) {
 		return
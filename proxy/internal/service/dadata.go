@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ekomobile/dadata/v2/api/suggest"
+	"github.com/ekomobile/dadata/v2/client"
+)
+
+// DaDataProvider looks addresses up with the DaData suggestions API.
+type DaDataProvider struct {
+	api       *suggest.Api
+	http      *http.Client
+	apiKey    string
+	secretKey string
+}
+
+func NewDaDataProvider(apiKey, secretKey string) *DaDataProvider {
+	endpointUrl, _ := url.Parse("https://suggestions.dadata.ru/suggestions/api/4_1/rs/")
+
+	creds := client.Credentials{
+		ApiKeyValue:    apiKey,
+		SecretKeyValue: secretKey,
+	}
+
+	httpClient := newHTTPClient()
+	api := suggest.Api{
+		Client: client.NewClient(endpointUrl, client.WithCredentialProvider(&creds), client.WithHttpClient(httpClient)),
+	}
+
+	return &DaDataProvider{
+		api:       &api,
+		http:      httpClient,
+		apiKey:    apiKey,
+		secretKey: secretKey,
+	}
+}
+
+// NewDaDataProviderFromSettings creates the provider from the api_key and
+// secret_key settings.
+func NewDaDataProviderFromSettings(settings Settings) (GeoProvider, error) {
+	apiKey, err := settings.Require("api_key")
+	if err != nil {
+		return nil, err
+	}
+	secretKey, err := settings.Require("secret_key")
+	if err != nil {
+		return nil, err
+	}
+	return NewDaDataProvider(apiKey, secretKey), nil
+}
+
+func (g *DaDataProvider) AddressSearch(ctx context.Context, input string) ([]*Address, error) {
+	var res []*Address
+	rawRes, err := g.api.Address(ctx, &suggest.RequestParams{Query: input})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rawRes {
+		if r.Data.City == "" || r.Data.Street == "" {
+			continue
+		}
+		res = append(res, &Address{City: r.Data.City, Street: r.Data.Street, House: r.Data.House, Lat: r.Data.GeoLat, Lon: r.Data.GeoLon})
+	}
+
+	return res, nil
+}
+
+func (g *DaDataProvider) GeoCode(ctx context.Context, lat, lng string) ([]*Address, error) {
+	latValue, lngValue, err := parseCoordinates(lat, lng)
+	if err != nil {
+		return nil, err
+	}
+	var data = strings.NewReader(fmt.Sprintf(`{"lat": %s, "lon": %s}`, formatCoordinate(latValue), formatCoordinate(lngValue)))
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://suggestions.dadata.ru/suggestions/api/4_1/rs/geolocate/address", data)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", g.apiKey))
+	resp, err := g.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var geoCode GeoCode
+
+	err = json.NewDecoder(resp.Body).Decode(&geoCode)
+	if err != nil {
+		return nil, err
+	}
+	var res []*Address
+	for _, r := range geoCode.Suggestions {
+		var address Address
+		address.City = string(r.Data.City)
+		address.Street = string(r.Data.Street)
+		address.House = r.Data.House
+		address.Lat = r.Data.GeoLat
+		address.Lon = r.Data.GeoLon
+
+		res = append(res, &address)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// NominatimProvider talks to the Nominatim API of OpenStreetMap or a
+// compatible self-hosted instance.
+type NominatimProvider struct {
+	baseURL   *url.URL
+	userAgent string
+	email     string
+	http      *http.Client
+}
+
+// NewNominatimProvider creates the provider from the url, user_agent and
+// email settings. The public instance requires an identifying User-Agent.
+func NewNominatimProvider(settings Settings) (GeoProvider, error) {
+	baseURL, err := settings.URL("url", "https://nominatim.openstreetmap.org")
+	if err != nil {
+		return nil, err
+	}
+	return &NominatimProvider{
+		baseURL:   baseURL,
+		userAgent: settings.Get("user_agent", "HugoProxy"),
+		email:     settings.Get("email", ""),
+		http:      newHTTPClient(),
+	}, nil
+}
+
+type nominatimPlace struct {
+	Lat     string `json:"lat"`
+	Lon     string `json:"lon"`
+	Address struct {
+		City        string `json:"city"`
+		Town        string `json:"town"`
+		Village     string `json:"village"`
+		Road        string `json:"road"`
+		HouseNumber string `json:"house_number"`
+	} `json:"address"`
+}
+
+func (p *NominatimProvider) AddressSearch(ctx context.Context, input string) ([]*Address, error) {
+	var places []nominatimPlace
+	err := p.get(ctx, "search", url.Values{
+		"q":     {input},
+		"limit": {strconv.Itoa(maxResults)},
+	}, &places)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*Address
+	for _, place := range places {
+		if address := place.toAddress(); address.City != "" && address.Street != "" {
+			res = append(res, address)
+		}
+	}
+	return res, nil
+}
+
+func (p *NominatimProvider) GeoCode(ctx context.Context, lat, lng string) ([]*Address, error) {
+	latValue, lngValue, err := parseCoordinates(lat, lng)
+	if err != nil {
+		return nil, err
+	}
+	var place struct {
+		nominatimPlace
+		Error string `json:"error"`
+	}
+	if err := p.get(ctx, "reverse", url.Values{"lat": {formatCoordinate(latValue)}, "lon": {formatCoordinate(lngValue)}}, &place); err != nil {
+		return nil, err
+	}
+	if place.Error != "" {
+		return nil, fmt.Errorf("nominatim reverse geocoding: %s", place.Error)
+	}
+	return []*Address{place.toAddress()}, nil
+}
+
+func (p *NominatimProvider) get(ctx context.Context, path string, query url.Values, target interface{}) error {
+	query.Set("format", "jsonv2")
+	query.Set("addressdetails", "1")
+	if p.email != "" {
+		query.Set("email", p.email)
+	}
+	endpoint := p.baseURL.JoinPath(path)
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", p.userAgent)
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+func (p nominatimPlace) toAddress() *Address {
+	city := p.Address.City
+	if city == "" {
+		city = p.Address.Town
+	}
+	if city == "" {
+		city = p.Address.Village
+	}
+	return &Address{
+		City:   city,
+		Street: p.Address.Road,
+		House:  p.Address.HouseNumber,
+		Lat:    p.Lat,
+		Lon:    p.Lon,
+	}
+}
@@ -2,48 +2,32 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
-
-	"github.com/ekomobile/dadata/v2/api/suggest"
-	"github.com/ekomobile/dadata/v2/client"
+	"time"
 )
 
-type GeoService struct {
-	api       *suggest.Api
-	apiKey    string
-	secretKey string
-}
-
-type GeoProvider interface {
-	AddressSearch(input string) ([]*Address, error)
-	GeoCode(lat, lng string) ([]*Address, error)
-}
-
-func NewGeoService(apiKey, secretKey string) *GeoService {
-	var err error
-	endpointUrl, err := url.Parse("https://suggestions.dadata.ru/suggestions/api/4_1/rs/")
-	if err != nil {
-		return nil
-	}
+// maxResults limits the number of addresses providers return.
+const maxResults = 10
 
-	creds := client.Credentials{
-		ApiKeyValue:    apiKey,
-		SecretKeyValue: secretKey,
-	}
+// providerTimeout bounds the requests to external providers.
+const providerTimeout = 10 * time.Second
 
-	api := suggest.Api{
-		Client: client.NewClient(endpointUrl, client.WithCredentialProvider(&creds)),
-	}
+// ErrInvalidCoordinates is returned by GeoCode for coordinates that are not
+// numbers or out of range.
+var ErrInvalidCoordinates = errors.New("invalid coordinates")
 
-	return &GeoService{
-		api:       &api,
-		apiKey:    apiKey,
-		secretKey: secretKey,
-	}
+// GeoProvider finds addresses by a text query and by coordinates. Requests
+// to the upstream are canceled with ctx.
+type GeoProvider interface {
+	AddressSearch(ctx context.Context, input string) ([]*Address, error)
+	GeoCode(ctx context.Context, lat, lng string) ([]*Address, error)
 }
 
 type Address struct {
@@ -54,54 +38,112 @@ type Address struct {
 	Lon    string `json:"lon"`
 }
 
-func (g *GeoService) AddressSearch(input string) ([]*Address, error) {
-	var res []*Address
-	rawRes, err := g.api.Address(context.Background(), &suggest.RequestParams{Query: input})
-	if err != nil {
-		return nil, err
+// Settings are the provider specific options, e.g. "api_key". Keys are
+// lower case.
+type Settings map[string]string
+
+// Get returns the setting or fallback if it is not set.
+func (s Settings) Get(key, fallback string) string {
+	if value := s[key]; value != "" {
+		return value
 	}
+	return fallback
+}
 
-	for _, r := range rawRes {
-		if r.Data.City == "" || r.Data.Street == "" {
-			continue
-		}
-		res = append(res, &Address{City: r.Data.City, Street: r.Data.Street, House: r.Data.House, Lat: r.Data.GeoLat, Lon: r.Data.GeoLon})
+// Require returns the setting or an error naming the missing key.
+func (s Settings) Require(key string) (string, error) {
+	value := s[key]
+	if value == "" {
+		return "", fmt.Errorf("setting %s is required", key)
 	}
+	return value, nil
+}
 
-	return res, nil
+// URL returns the setting as an absolute http(s) URL.
+func (s Settings) URL(key, fallback string) (*url.URL, error) {
+	u, err := url.Parse(s.Get(key, fallback))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("setting %s must be an absolute http(s) URL", key)
+	}
+	return u, nil
 }
 
-func (g *GeoService) GeoCode(lat, lng string) ([]*Address, error) {
-	httpClient := &http.Client{}
-	var data = strings.NewReader(fmt.Sprintf(`{"lat": %s, "lon": %s}`, lat, lng))
-	req, err := http.NewRequest("POST", "https://suggestions.dadata.ru/suggestions/api/4_1/rs/geolocate/address", data)
-	if err != nil {
-		return nil, err
+// ProviderFactory creates a provider from its settings. It validates the
+// settings, so a misconfigured provider is reported at startup.
+type ProviderFactory func(settings Settings) (GeoProvider, error)
+
+// Registry holds the geo providers available by name.
+type Registry struct {
+	factories map[string]ProviderFactory
+}
+
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]ProviderFactory)}
+}
+
+// DefaultRegistry returns a registry with all providers of this package.
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.Register("dadata", NewDaDataProviderFromSettings)
+	r.Register("nominatim", NewNominatimProvider)
+	r.Register("yandex", NewYandexProvider)
+	r.Register("static", NewStaticProvider)
+	return r
+}
+
+func (r *Registry) Register(name string, factory ProviderFactory) {
+	r.factories[name] = factory
+}
+
+// Names returns the registered provider names in alphabetical order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Token %s", g.apiKey))
-	resp, err := httpClient.Do(req)
+	sort.Strings(names)
+	return names
+}
+
+// New creates the named provider.
+func (r *Registry) New(name string, settings Settings) (GeoProvider, error) {
+	factory, ok := r.factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown geo provider %q, available: %s", name, strings.Join(r.Names(), ", "))
+	}
+	provider, err := factory(settings)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("geo provider %s: %w", name, err)
 	}
-	var geoCode GeoCode
+	return provider, nil
+}
 
-	err = json.NewDecoder(resp.Body).Decode(&geoCode)
-	if err != nil {
-		return nil, err
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: providerTimeout}
+}
+
+// checkStatus turns a non-2xx response into an error.
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("provider responded with %s", resp.Status)
 	}
-	var res []*Address
-	for _, r := range geoCode.Suggestions {
-		var address Address
-		address.City = string(r.Data.City)
-		address.Street = string(r.Data.Street)
-		address.House = r.Data.House
-		address.Lat = r.Data.GeoLat
-		address.Lon = r.Data.GeoLon
-
-		res = append(res, &address)
+	return nil
+}
+
+// parseCoordinates parses and range checks the coordinates. Errors wrap
+// ErrInvalidCoordinates.
+func parseCoordinates(lat, lng string) (float64, float64, error) {
+	latValue, err := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	if err != nil || math.IsNaN(latValue) || latValue < -90 || latValue > 90 {
+		return 0, 0, fmt.Errorf("%w: latitude must be a number between -90 and 90", ErrInvalidCoordinates)
 	}
+	lngValue, err := strconv.ParseFloat(strings.TrimSpace(lng), 64)
+	if err != nil || math.IsNaN(lngValue) || lngValue < -180 || lngValue > 180 {
+		return 0, 0, fmt.Errorf("%w: longitude must be a number between -180 and 180", ErrInvalidCoordinates)
+	}
+	return latValue, lngValue, nil
+}
 
-	return res, nil
+func formatCoordinate(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
 }
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// StaticProvider answers from a fixed list of addresses loaded from a JSON
+// file. It is meant for development and tests without network access.
+type StaticProvider struct {
+	addresses []*Address
+}
+
+// NewStaticProvider loads the addresses from the file setting, a JSON array
+// of addresses as returned by the API.
+func NewStaticProvider(settings Settings) (GeoProvider, error) {
+	path, err := settings.Require("file")
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var addresses []*Address
+	if err := json.Unmarshal(data, &addresses); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for i, address := range addresses {
+		if _, _, err := parseCoordinates(address.Lat, address.Lon); err != nil {
+			return nil, fmt.Errorf("address %d in %s: %w", i, path, err)
+		}
+	}
+	return &StaticProvider{addresses: addresses}, nil
+}
+
+// AddressSearch returns the addresses that contain every word of the query.
+func (p *StaticProvider) AddressSearch(ctx context.Context, input string) ([]*Address, error) {
+	words := strings.Fields(strings.ToLower(strings.ReplaceAll(input, ",", " ")))
+
+	var res []*Address
+	for _, address := range p.addresses {
+		text := strings.ToLower(address.City + " " + address.Street + " " + address.House)
+		matches := true
+		for _, word := range words {
+			if !strings.Contains(text, word) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			res = append(res, address)
+		}
+		if len(res) == maxResults {
+			break
+		}
+	}
+	return res, nil
+}
+
+// GeoCode returns the addresses closest to the coordinates.
+func (p *StaticProvider) GeoCode(ctx context.Context, lat, lng string) ([]*Address, error) {
+	latValue, lngValue, err := parseCoordinates(lat, lng)
+	if err != nil {
+		return nil, err
+	}
+
+	res := append([]*Address(nil), p.addresses...)
+	distance := func(address *Address) float64 {
+		addressLat, addressLng, _ := parseCoordinates(address.Lat, address.Lon)
+		return math.Hypot(addressLat-latValue, addressLng-lngValue)
+	}
+	sort.SliceStable(res, func(i, j int) bool { return distance(res[i]) < distance(res[j]) })
+	if len(res) > maxResults {
+		res = res[:maxResults]
+	}
+	return res, nil
+}
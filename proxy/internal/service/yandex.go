@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// YandexProvider talks to the Yandex Geocoder HTTP API or a service with a
+// compatible interface.
+type YandexProvider struct {
+	baseURL *url.URL
+	apiKey  string
+	lang    string
+	http    *http.Client
+}
+
+// NewYandexProvider creates the provider from the api_key, url and lang
+// settings.
+func NewYandexProvider(settings Settings) (GeoProvider, error) {
+	apiKey, err := settings.Require("api_key")
+	if err != nil {
+		return nil, err
+	}
+	baseURL, err := settings.URL("url", "https://geocode-maps.yandex.ru/1.x/")
+	if err != nil {
+		return nil, err
+	}
+	return &YandexProvider{
+		baseURL: baseURL,
+		apiKey:  apiKey,
+		lang:    settings.Get("lang", "ru_RU"),
+		http:    newHTTPClient(),
+	}, nil
+}
+
+type yandexResponse struct {
+	Response struct {
+		GeoObjectCollection struct {
+			FeatureMember []struct {
+				GeoObject struct {
+					MetaDataProperty struct {
+						GeocoderMetaData struct {
+							Address struct {
+								Components []struct {
+									Kind string `json:"kind"`
+									Name string `json:"name"`
+								} `json:"Components"`
+							} `json:"Address"`
+						} `json:"GeocoderMetaData"`
+					} `json:"metaDataProperty"`
+					Point struct {
+						// Pos is "<lon> <lat>".
+						Pos string `json:"pos"`
+					} `json:"Point"`
+				} `json:"GeoObject"`
+			} `json:"featureMember"`
+		} `json:"GeoObjectCollection"`
+	} `json:"response"`
+}
+
+func (p *YandexProvider) AddressSearch(ctx context.Context, input string) ([]*Address, error) {
+	addresses, err := p.geocode(ctx, url.Values{"geocode": {input}})
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*Address
+	for _, address := range addresses {
+		if address.City != "" && address.Street != "" {
+			res = append(res, address)
+		}
+	}
+	return res, nil
+}
+
+func (p *YandexProvider) GeoCode(ctx context.Context, lat, lng string) ([]*Address, error) {
+	latValue, lngValue, err := parseCoordinates(lat, lng)
+	if err != nil {
+		return nil, err
+	}
+	return p.geocode(ctx, url.Values{"geocode": {formatCoordinate(lngValue) + "," + formatCoordinate(latValue)}, "kind": {"house"}})
+}
+
+func (p *YandexProvider) geocode(ctx context.Context, query url.Values) ([]*Address, error) {
+	query.Set("apikey", p.apiKey)
+	query.Set("format", "json")
+	query.Set("lang", p.lang)
+	query.Set("results", strconv.Itoa(maxResults))
+	endpoint := *p.baseURL
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+
+	var data yandexResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	var res []*Address
+	for _, member := range data.Response.GeoObjectCollection.FeatureMember {
+		object := member.GeoObject
+		var address Address
+		for _, component := range object.MetaDataProperty.GeocoderMetaData.Address.Components {
+			switch component.Kind {
+			case "locality":
+				address.City = component.Name
+			case "street":
+				address.Street = component.Name
+			case "house":
+				address.House = component.Name
+			}
+		}
+		if lon, lat, ok := strings.Cut(object.Point.Pos, " "); ok {
+			address.Lat, address.Lon = lat, lon
+		}
+		res = append(res, &address)
+	}
+	return res, nil
+}
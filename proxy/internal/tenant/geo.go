@@ -0,0 +1,83 @@
+package tenant
+
+import (
+	"sync"
+
+	"test/internal/service"
+)
+
+// tenantKeysProvider is the only provider the DaData keys of tenants are
+// meant for.
+const tenantKeysProvider = "dadata"
+
+// GeoServices keeps a DaData provider per tenant that brings its own keys.
+// Providers are created through the registry with the settings of the
+// service, the tenant's keys replacing the api_key and secret_key settings,
+// and rebuilt when the keys change. When the service uses another provider,
+// tenant keys are ignored, so they are never sent to another vendor.
+type GeoServices struct {
+	mu       sync.Mutex
+	registry *service.Registry
+	provider string
+	settings service.Settings
+	services map[int64]*tenantGeoService
+}
+
+type tenantGeoService struct {
+	apiKey    string
+	secretKey string
+	service   service.GeoProvider
+}
+
+func NewGeoServices(registry *service.Registry, provider string, settings service.Settings) *GeoServices {
+	return &GeoServices{
+		registry: registry,
+		provider: provider,
+		settings: settings,
+		services: make(map[int64]*tenantGeoService),
+	}
+}
+
+// For returns the geo provider of the tenant, or nil if the tenant uses the
+// default provider.
+func (g *GeoServices) For(tenant *Tenant) (service.GeoProvider, error) {
+	if !tenant.HasGeoCredentials() || g.provider != tenantKeysProvider {
+		return nil, nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s, ok := g.services[tenant.ID]
+	if !ok || s.apiKey != tenant.DaDataAPIKey || s.secretKey != tenant.DaDataSecretKey {
+		provider, err := g.registry.New(g.provider, g.tenantSettings(tenant))
+		if err != nil {
+			return nil, err
+		}
+		s = &tenantGeoService{
+			apiKey:    tenant.DaDataAPIKey,
+			secretKey: tenant.DaDataSecretKey,
+			service:   provider,
+		}
+		g.services[tenant.ID] = s
+	}
+	return s.service, nil
+}
+
+// Forget drops the provider of a changed or deleted tenant.
+func (g *GeoServices) Forget(id int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.services, id)
+}
+
+func (g *GeoServices) tenantSettings(tenant *Tenant) service.Settings {
+	settings := make(service.Settings, len(g.settings)+2)
+	for key, value := range g.settings {
+		settings[key] = value
+	}
+	settings["api_key"] = tenant.DaDataAPIKey
+	settings["secret_key"] = tenant.DaDataSecretKey
+	return settings
+}
@@ -0,0 +1,63 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"test/internal/service"
+)
+
+type fakeProvider struct {
+	settings service.Settings
+}
+
+func (p *fakeProvider) AddressSearch(ctx context.Context, input string) ([]*service.Address, error) {
+	return nil, nil
+}
+
+func (p *fakeProvider) GeoCode(ctx context.Context, lat, lng string) ([]*service.Address, error) {
+	return nil, nil
+}
+
+func fakeRegistry(built *int) *service.Registry {
+	registry := service.NewRegistry()
+	factory := func(settings service.Settings) (service.GeoProvider, error) {
+		*built++
+		return &fakeProvider{settings: settings}, nil
+	}
+	registry.Register("dadata", factory)
+	registry.Register("yandex", factory)
+	return registry
+}
+
+func TestGeoServicesUseTenantKeysOnlyForDaData(t *testing.T) {
+	tenant := &Tenant{ID: 1, DaDataAPIKey: "tenant-key", DaDataSecretKey: "tenant-secret"}
+
+	var built int
+	yandex := NewGeoServices(fakeRegistry(&built), "yandex", service.Settings{"api_key": "service-key"})
+	provider, err := yandex.For(tenant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider != nil || built != 0 {
+		t.Error("tenant DaData keys were used for another provider")
+	}
+
+	dadata := NewGeoServices(fakeRegistry(&built), "dadata", service.Settings{"api_key": "service-key", "secret_key": "service-secret"})
+	provider, err = dadata.For(tenant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := provider.(*fakeProvider).settings
+	if settings["api_key"] != "tenant-key" || settings["secret_key"] != "tenant-secret" {
+		t.Errorf("provider built with %v", settings)
+	}
+
+	if _, err := dadata.For(tenant); err != nil || built != 1 {
+		t.Errorf("provider was built %d times, want once", built)
+	}
+	dadata.Forget(tenant.ID)
+	if _, err := dadata.For(tenant); err != nil || built != 2 {
+		t.Errorf("provider was not rebuilt after Forget")
+	}
+}
@@ -0,0 +1,118 @@
+package tenant
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRateLimited   = errors.New("tenant rate limit exceeded")
+	ErrQuotaExceeded = errors.New("tenant daily quota exceeded")
+)
+
+// Limiter enforces the rate limits and daily quotas of tenants. The rate
+// limit is a token bucket refilled evenly over a minute. Usage is kept in
+// memory, so quotas start over when the service restarts.
+type Limiter struct {
+	mu    sync.Mutex
+	usage map[int64]*usage
+}
+
+type usage struct {
+	tokens     float64
+	refilledAt time.Time
+	day        string
+	used       int
+	// exceeded is set once the quota of the day was hit.
+	exceeded bool
+}
+
+// Usage is the number of requests a tenant made on the current UTC day.
+type Usage struct {
+	Day  string `json:"day" example:"2026-10-18"`
+	Used int    `json:"used" example:"120"`
+	// Remaining is omitted when the tenant has no daily quota.
+	Remaining *int `json:"remaining,omitempty" example:"880"`
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{usage: make(map[int64]*usage)}
+}
+
+// Allow counts a request of the tenant. If the request is over a limit it
+// returns ErrRateLimited or ErrQuotaExceeded together with the time until
+// the next request is allowed. first is set for the first rejection of a
+// day because of the quota.
+func (l *Limiter) Allow(tenant *Tenant, now time.Time) (wait time.Duration, first bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	u := l.get(tenant.ID, now)
+	if tenant.DailyQuota > 0 && u.used >= tenant.DailyQuota {
+		first = !u.exceeded
+		u.exceeded = true
+		midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return midnight.Sub(now), first, ErrQuotaExceeded
+	}
+
+	if tenant.RateLimit > 0 {
+		perSecond := float64(tenant.RateLimit) / 60
+		if u.refilledAt.IsZero() {
+			u.tokens = float64(tenant.RateLimit)
+		} else {
+			u.tokens += now.Sub(u.refilledAt).Seconds() * perSecond
+		}
+		if u.tokens > float64(tenant.RateLimit) {
+			u.tokens = float64(tenant.RateLimit)
+		}
+		u.refilledAt = now
+		if u.tokens < 1 {
+			return time.Duration((1 - u.tokens) / perSecond * float64(time.Second)), false, ErrRateLimited
+		}
+		u.tokens--
+	}
+
+	u.used++
+	return 0, false, nil
+}
+
+// Usage returns the usage of the tenant on the current day.
+func (l *Limiter) Usage(tenant *Tenant, now time.Time) Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	u := l.get(tenant.ID, now)
+	res := Usage{Day: u.day, Used: u.used}
+	if tenant.DailyQuota > 0 {
+		remaining := tenant.DailyQuota - u.used
+		if remaining < 0 {
+			remaining = 0
+		}
+		res.Remaining = &remaining
+	}
+	return res
+}
+
+// Forget drops the usage of a deleted tenant.
+func (l *Limiter) Forget(id int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.usage, id)
+}
+
+func (l *Limiter) get(id int64, now time.Time) *usage {
+	day := now.UTC().Format(time.DateOnly)
+	u, ok := l.usage[id]
+	if !ok {
+		u = &usage{}
+		l.usage[id] = u
+	}
+	if u.day != day {
+		u.day = day
+		u.used = 0
+		u.exceeded = false
+	}
+	return u
+}
@@ -0,0 +1,35 @@
+package tenant
+
+import (
+	"expvar"
+	"strconv"
+	"sync"
+)
+
+const (
+	MetricRequests      = "requests"
+	MetricRateLimited   = "rate_limited"
+	MetricQuotaExceeded = "quota_exceeded"
+)
+
+var (
+	// metrics holds a map of counters per tenant ID, published by the
+	// expvar handler as "tenants".
+	metrics   = expvar.NewMap("tenants")
+	metricsMu sync.Mutex
+)
+
+// Count increments a counter of the tenant.
+func Count(tenant *Tenant, metric string) {
+	key := strconv.FormatInt(tenant.ID, 10)
+	counters, ok := metrics.Get(key).(*expvar.Map)
+	if !ok {
+		metricsMu.Lock()
+		if counters, ok = metrics.Get(key).(*expvar.Map); !ok {
+			counters = new(expvar.Map).Init()
+			metrics.Set(key, counters)
+		}
+		metricsMu.Unlock()
+	}
+	counters.Add(metric, 1)
+}
@@ -0,0 +1,141 @@
+package tenant
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"test/internal/database"
+)
+
+var migrations = []string{
+	`CREATE TABLE tenants (
+		id                INTEGER PRIMARY KEY AUTOINCREMENT,
+		name              TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		dadata_api_key    TEXT NOT NULL DEFAULT '',
+		dadata_secret_key TEXT NOT NULL DEFAULT '',
+		rate_limit        INTEGER NOT NULL DEFAULT 0,
+		daily_quota       INTEGER NOT NULL DEFAULT 0,
+		created_at        TIMESTAMP NOT NULL,
+		updated_at        TIMESTAMP NOT NULL
+	)`,
+}
+
+const columns = `id, name, dadata_api_key, dadata_secret_key, rate_limit, daily_quota, created_at, updated_at`
+
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRepository(db *sql.DB) (*SQLiteRepository, error) {
+	if err := database.Migrate(db, "tenants", migrations); err != nil {
+		return nil, err
+	}
+	return &SQLiteRepository{db: db}, nil
+}
+
+func (r *SQLiteRepository) Create(ctx context.Context, tenant *Tenant) error {
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO tenants (name, dadata_api_key, dadata_secret_key, rate_limit, daily_quota, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		tenant.Name, tenant.DaDataAPIKey, tenant.DaDataSecretKey, tenant.RateLimit, tenant.DailyQuota, now, now,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrTenantExists
+		}
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	tenant.ID = id
+	tenant.CreatedAt = now
+	tenant.UpdatedAt = now
+	return nil
+}
+
+func (r *SQLiteRepository) Get(ctx context.Context, id int64) (*Tenant, error) {
+	tenant, err := scanTenant(r.db.QueryRowContext(ctx, `SELECT `+columns+` FROM tenants WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTenantNotFound
+	}
+	return tenant, err
+}
+
+func (r *SQLiteRepository) List(ctx context.Context) ([]*Tenant, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+columns+` FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []*Tenant{}
+	for rows.Next() {
+		tenant, err := scanTenant(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, tenant)
+	}
+	return res, rows.Err()
+}
+
+func (r *SQLiteRepository) Update(ctx context.Context, tenant *Tenant) error {
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE tenants SET name = ?, dadata_api_key = ?, dadata_secret_key = ?, rate_limit = ?, daily_quota = ?, updated_at = ? WHERE id = ?`,
+		tenant.Name, tenant.DaDataAPIKey, tenant.DaDataSecretKey, tenant.RateLimit, tenant.DailyQuota, now, tenant.ID,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrTenantExists
+		}
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTenantNotFound
+	}
+	tenant.UpdatedAt = now
+	return nil
+}
+
+func (r *SQLiteRepository) Delete(ctx context.Context, id int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM tenants WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTenantNotFound
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTenant(row rowScanner) (*Tenant, error) {
+	var tenant Tenant
+	err := row.Scan(&tenant.ID, &tenant.Name, &tenant.DaDataAPIKey, &tenant.DaDataSecretKey,
+		&tenant.RateLimit, &tenant.DailyQuota, &tenant.CreatedAt, &tenant.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+func isUniqueViolation(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
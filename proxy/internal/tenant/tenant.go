@@ -0,0 +1,150 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTenantNotFound = errors.New("tenant not found")
+	ErrTenantExists   = errors.New("tenant already exists")
+)
+
+// Tenant is an organization sharing the deployment with others. Users of a
+// tenant use its geo provider credentials and share its limits. Zero limits
+// mean unlimited, empty credentials mean the default ones of the deployment.
+type Tenant struct {
+	ID              int64
+	Name            string
+	DaDataAPIKey    string
+	DaDataSecretKey string
+	// RateLimit is the number of address requests per minute.
+	RateLimit int
+	// DailyQuota is the number of address requests per UTC day.
+	DailyQuota int
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// HasGeoCredentials reports whether the tenant brings its own DaData keys.
+func (t *Tenant) HasGeoCredentials() bool {
+	return t.DaDataAPIKey != "" && t.DaDataSecretKey != ""
+}
+
+type Repository interface {
+	Create(ctx context.Context, tenant *Tenant) error
+	Get(ctx context.Context, id int64) (*Tenant, error)
+	List(ctx context.Context) ([]*Tenant, error)
+	Update(ctx context.Context, tenant *Tenant) error
+	Delete(ctx context.Context, id int64) error
+}
+
+type MemoryRepository struct {
+	mu      sync.RWMutex
+	lastID  int64
+	tenants map[int64]*Tenant
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{tenants: make(map[int64]*Tenant)}
+}
+
+func (r *MemoryRepository) Create(ctx context.Context, tenant *Tenant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.nameTaken(tenant.Name, 0) {
+		return ErrTenantExists
+	}
+	now := time.Now().UTC()
+	r.lastID++
+	tenant.ID = r.lastID
+	tenant.CreatedAt = now
+	tenant.UpdatedAt = now
+
+	stored := *tenant
+	r.tenants[tenant.ID] = &stored
+	return nil
+}
+
+func (r *MemoryRepository) Get(ctx context.Context, id int64) (*Tenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenant, ok := r.tenants[id]
+	if !ok {
+		return nil, ErrTenantNotFound
+	}
+	found := *tenant
+	return &found, nil
+}
+
+func (r *MemoryRepository) List(ctx context.Context) ([]*Tenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]*Tenant, 0, len(r.tenants))
+	for _, tenant := range r.tenants {
+		found := *tenant
+		res = append(res, &found)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+func (r *MemoryRepository) Update(ctx context.Context, tenant *Tenant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.tenants[tenant.ID]
+	if !ok {
+		return ErrTenantNotFound
+	}
+	if r.nameTaken(tenant.Name, tenant.ID) {
+		return ErrTenantExists
+	}
+	tenant.CreatedAt = current.CreatedAt
+	tenant.UpdatedAt = time.Now().UTC()
+
+	stored := *tenant
+	r.tenants[tenant.ID] = &stored
+	return nil
+}
+
+func (r *MemoryRepository) Delete(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tenants[id]; !ok {
+		return ErrTenantNotFound
+	}
+	delete(r.tenants, id)
+	return nil
+}
+
+func (r *MemoryRepository) nameTaken(name string, exceptID int64) bool {
+	for _, tenant := range r.tenants {
+		if tenant.ID != exceptID && strings.EqualFold(tenant.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// NewContext stores the tenant the request is made for.
+func NewContext(ctx context.Context, tenant *Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenant)
+}
+
+// FromContext returns the tenant of the request. It reports false for users
+// without a tenant.
+func FromContext(ctx context.Context) (*Tenant, bool) {
+	tenant, ok := ctx.Value(contextKey{}).(*Tenant)
+	return tenant, ok
+}